@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"context"
+	"riser-controller/pkg/util"
+	"sort"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/rest"
+	"knative.dev/serving/pkg/apis/serving"
+	knserving "knative.dev/serving/pkg/apis/serving/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CacheSelectors restrict the manager's informers to the objects that the reconcilers need. Riser configurations, routes and sealed secrets
+// always have the riser app label. Knative always labels a revision's deployments with the configuration. Pods are not cached (see getPods). The only ConfigMaps needed
+// are knative's config in the knative serving namespace.
+func CacheSelectors(sealedSecretEnabled bool) cache.SelectorsByObject {
+	riserApp := hasLabelSelector(riserLabel("app"))
+	knativeConfiguration := hasLabelSelector(serving.ConfigurationLabelKey)
+	configuration := &knserving.Configuration{}
+	selectors := cache.SelectorsByObject{
+		configuration:        {Label: riserApp},
+		&knserving.Route{}:   {Label: riserApp},
+		&appsv1.Deployment{}: {Label: knativeConfiguration},
+		&corev1.ConfigMap{}:  {Field: fields.OneTermEqualSelector("metadata.namespace", util.KNativeServingNamespace)},
+	}
+	if sealedSecretEnabled {
+		sealedSecret := &unstructured.Unstructured{}
+		sealedSecret.SetGroupVersionKind(sealedSecretGVK)
+		selectors[sealedSecret] = selectors[configuration]
+	}
+	return selectors
+}
+
+// NewCacheFunc returns a cache restricted to the namespaces (all namespaces when empty) and selectors. Cluster scoped objects are always cached.
+func NewCacheFunc(namespaces []string, selectors cache.SelectorsByObject) cache.NewCacheFunc {
+	return func(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+		opts.SelectorsByObject = selectors
+		if len(namespaces) == 0 {
+			return cache.New(config, opts)
+		}
+		return cache.MultiNamespacedCacheBuilder(namespaces)(config, opts)
+	}
+}
+
+// ResolveWatchNamespaces returns the namespaces to watch: the namespaces specified plus the namespaces matching the label selector. The knative
+// serving namespace is always included since its config is watched. Returns an empty list (all namespaces) if neither are specified.
+// Namespaces created after startup that match the selector are not watched until the controller is restarted.
+func ResolveWatchNamespaces(ctx context.Context, reader client.Reader, namespaces []string, selector string) ([]string, error) {
+	if len(namespaces) == 0 && selector == "" {
+		return []string{}, nil
+	}
+
+	watchNamespaces := map[string]bool{util.KNativeServingNamespace: true}
+	for _, namespace := range namespaces {
+		watchNamespaces[namespace] = true
+	}
+
+	if selector != "" {
+		labelSelector, err := labels.Parse(selector)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid namespace selector")
+		}
+		namespaceList := &metav1.PartialObjectMetadataList{}
+		namespaceList.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("NamespaceList"))
+		err = reader.List(ctx, namespaceList, client.MatchingLabelsSelector{Selector: labelSelector})
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to list namespaces")
+		}
+		for _, namespace := range namespaceList.Items {
+			watchNamespaces[namespace.Name] = true
+		}
+	}
+
+	result := []string{}
+	for namespace := range watchNamespaces {
+		result = append(result, namespace)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func hasLabelSelector(key string) labels.Selector {
+	requirement, err := labels.NewRequirement(key, selection.Exists, nil)
+	if err != nil {
+		// The keys are constants so this can only happen due to a programming error
+		panic(err)
+	}
+	return labels.NewSelector().Add(*requirement)
+}
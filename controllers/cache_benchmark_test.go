@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"riser-controller/pkg/util"
+	goruntime "runtime"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"knative.dev/serving/pkg/apis/serving"
+	knserving "knative.dev/serving/pkg/apis/serving/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+/*
+BenchmarkCacheMemory measures the heap used by the manager cache's Deployment and ConfigMap informers in a shared cluster with thousands of
+objects, of which only a fraction belong to knative. The cache is created with cache.New and CacheSelectors as in main.go. The informers
+list from a fake API server that applies the label and field selectors of each request the same way that the API server does, so that only
+the objects selected by the cache are returned.
+
+	go test ./controllers -run NONE -bench CacheMemory -benchtime 3x
+*/
+func BenchmarkCacheMemory(b *testing.B) {
+	server := newBenchmarkAPIServer(newBenchmarkObjects(5000))
+	defer server.Close()
+	metadataDeployment := &metav1.PartialObjectMetadata{}
+	metadataDeployment.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+
+	b.Run("all objects", func(b *testing.B) {
+		benchmarkCacheMemory(b, server.URL, cache.SelectorsByObject{}, &appsv1.Deployment{}, &corev1.ConfigMap{})
+	})
+
+	b.Run("selectors", func(b *testing.B) {
+		benchmarkCacheMemory(b, server.URL, CacheSelectors(false), &appsv1.Deployment{}, &corev1.ConfigMap{})
+	})
+
+	b.Run("selectors and metadata only deployments", func(b *testing.B) {
+		benchmarkCacheMemory(b, server.URL, CacheSelectors(false), metadataDeployment, &corev1.ConfigMap{})
+	})
+}
+
+func benchmarkCacheMemory(b *testing.B, serverURL string, selectors cache.SelectorsByObject, objs ...client.Object) {
+	scheme := runtime.NewScheme()
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = knserving.AddToScheme(scheme)
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(appsv1.SchemeGroupVersion.WithKind("Deployment"), meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+
+	var heapBytes uint64
+	var cached int
+	for i := 0; i < b.N; i++ {
+		before := heapAlloc()
+		ctx, cancel := context.WithCancel(context.Background())
+		informerCache, err := cache.New(&rest.Config{Host: serverURL}, cache.Options{Scheme: scheme, Mapper: mapper, SelectorsByObject: selectors})
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, obj := range objs {
+			if _, err = informerCache.GetInformer(ctx, obj); err != nil {
+				b.Fatal(err)
+			}
+		}
+		go func() { _ = informerCache.Start(ctx) }()
+		if !informerCache.WaitForCacheSync(ctx) {
+			b.Fatal("cache did not sync")
+		}
+		heapBytes += heapAlloc() - before
+		cached = countCached(ctx, b, informerCache, objs)
+		cancel()
+	}
+	b.ReportMetric(float64(heapBytes)/float64(b.N)/1024/1024, "heap-MiB")
+	b.ReportMetric(float64(cached), "objects")
+}
+
+// countCached returns the number of objects of each type in the cache
+func countCached(ctx context.Context, b *testing.B, reader client.Reader, objs []client.Object) int {
+	count := 0
+	for _, obj := range objs {
+		var list client.ObjectList
+		switch obj.(type) {
+		case *appsv1.Deployment:
+			list = &appsv1.DeploymentList{}
+		case *corev1.ConfigMap:
+			list = &corev1.ConfigMapList{}
+		default:
+			metadataList := &metav1.PartialObjectMetadataList{}
+			metadataList.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("DeploymentList"))
+			list = metadataList
+		}
+		if err := reader.List(ctx, list); err != nil {
+			b.Fatal(err)
+		}
+		count += meta.LenList(list)
+	}
+	return count
+}
+
+func heapAlloc() uint64 {
+	goruntime.GC()
+	stats := goruntime.MemStats{}
+	goruntime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+// newBenchmarkAPIServer serves the list and watch requests of the Deployment and ConfigMap informers. Watches never send any events.
+func newBenchmarkAPIServer(objects []client.Object) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("watch") == "true" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+
+		labelSelector, err := labels.Parse(query.Get("labelSelector"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fieldSelector, err := fields.ParseSelector(query.Get("fieldSelector"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		selected := []client.Object{}
+		for _, obj := range objects {
+			isDeployment := strings.HasSuffix(r.URL.Path, "/deployments")
+			if _, ok := obj.(*appsv1.Deployment); ok != isDeployment {
+				continue
+			}
+			if labelSelector.Matches(labels.Set(obj.GetLabels())) && fieldSelector.Matches(fields.Set{"metadata.namespace": obj.GetNamespace()}) {
+				selected = append(selected, obj)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(newBenchmarkList(r, selected))
+	}))
+}
+
+// newBenchmarkList returns the objects as the list type requested by the informer
+func newBenchmarkList(r *http.Request, objects []client.Object) runtime.Object {
+	listMeta := metav1.ListMeta{ResourceVersion: "1"}
+	if strings.Contains(r.Header.Get("Accept"), "as=PartialObjectMetadataList") {
+		list := &metav1.PartialObjectMetadataList{ListMeta: listMeta}
+		list.SetGroupVersionKind(metav1.SchemeGroupVersion.WithKind("PartialObjectMetadataList"))
+		for _, obj := range objects {
+			list.Items = append(list.Items, metav1.PartialObjectMetadata{ObjectMeta: *obj.(metav1.ObjectMetaAccessor).GetObjectMeta().(*metav1.ObjectMeta)})
+		}
+		return list
+	}
+	if strings.HasSuffix(r.URL.Path, "/deployments") {
+		list := &appsv1.DeploymentList{ListMeta: listMeta}
+		list.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("DeploymentList"))
+		for _, obj := range objects {
+			list.Items = append(list.Items, *obj.(*appsv1.Deployment))
+		}
+		return list
+	}
+	list := &corev1.ConfigMapList{ListMeta: listMeta}
+	list.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMapList"))
+	for _, obj := range objects {
+		list.Items = append(list.Items, *obj.(*corev1.ConfigMap))
+	}
+	return list
+}
+
+// newBenchmarkObjects returns count Deployments and ConfigMaps across 100 namespaces. One in ten Deployments belongs to a knative revision.
+func newBenchmarkObjects(count int) []client.Object {
+	objects := []client.Object{}
+	for i := 0; i < count; i++ {
+		namespace := fmt.Sprintf("ns-%d", i%100)
+		deploymentLabels := map[string]string{"app": fmt.Sprintf("app-%d", i)}
+		if i%10 == 0 {
+			deploymentLabels[serving.ConfigurationLabelKey] = fmt.Sprintf("app-%d", i)
+		}
+		objects = append(objects, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("app-%d", i),
+				Namespace: namespace,
+				Labels:    deploymentLabels,
+				// Similar in size to kubectl's last applied configuration annotation
+				Annotations: map[string]string{"kubectl.kubernetes.io/last-applied-configuration": strings.Repeat("x", 2048)},
+			},
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: deploymentLabels},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{
+							{Name: "app", Image: "example.com/app:1.0.0", Env: benchmarkEnv(20)},
+							{Name: "sidecar", Image: "example.com/sidecar:1.0.0", Env: benchmarkEnv(10)},
+						},
+					},
+				},
+			},
+		})
+
+		configMapNamespace := namespace
+		if i%1000 == 0 {
+			configMapNamespace = util.KNativeServingNamespace
+		}
+		objects = append(objects, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("config-%d", i), Namespace: configMapNamespace},
+			Data:       map[string]string{"config.yaml": strings.Repeat("x", 4096)},
+		})
+	}
+	return objects
+}
+
+func benchmarkEnv(count int) []corev1.EnvVar {
+	env := make([]corev1.EnvVar, count)
+	for i := range env {
+		env[i] = corev1.EnvVar{Name: fmt.Sprintf("VAR_%d", i), Value: strings.Repeat("v", 64)}
+	}
+	return env
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	knserving "knative.dev/serving/pkg/apis/serving/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_CacheSelectors(t *testing.T) {
+	result := CacheSelectors(false)
+
+	assert.Len(t, result, 4)
+	for obj, selector := range result {
+		switch obj.(type) {
+		case *knserving.Configuration, *knserving.Route:
+			assert.True(t, selector.Label.Matches(labels.Set{"riser.dev/app": "myapp"}))
+			assert.False(t, selector.Label.Matches(labels.Set{"app": "myapp"}))
+		case *appsv1.Deployment:
+			assert.True(t, selector.Label.Matches(labels.Set{"serving.knative.dev/configuration": "myapp"}))
+			assert.False(t, selector.Label.Matches(labels.Set{"riser.dev/app": "myapp"}))
+		case *corev1.ConfigMap:
+			assert.True(t, selector.Field.Matches(fields.Set{"metadata.namespace": "knative-serving"}))
+			assert.False(t, selector.Field.Matches(fields.Set{"metadata.namespace": "myns"}))
+		default:
+			assert.Fail(t, "unexpected object", "%T", obj)
+		}
+	}
+}
+
+func Test_CacheSelectors_SealedSecretEnabled(t *testing.T) {
+	result := CacheSelectors(true)
+
+	assert.Len(t, result, 5)
+}
+
+func Test_ResolveWatchNamespaces(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-a", Labels: map[string]string{"riser.dev/tenant": "a"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-b", Labels: map[string]string{"riser.dev/tenant": "b"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+	).Build()
+
+	tests := []struct {
+		name       string
+		namespaces []string
+		selector   string
+		expected   []string
+	}{
+		{"all namespaces", nil, "", []string{}},
+		{"namespaces", []string{"myns", "otherns"}, "", []string{"knative-serving", "myns", "otherns"}},
+		{"selector", nil, "riser.dev/tenant", []string{"knative-serving", "tenant-a", "tenant-b"}},
+		{"namespaces and selector", []string{"myns", "tenant-a"}, "riser.dev/tenant=a", []string{"knative-serving", "myns", "tenant-a"}},
+	}
+
+	for _, tt := range tests {
+		result, err := ResolveWatchNamespaces(context.Background(), reader, tt.namespaces, tt.selector)
+		assert.NoError(t, err, "when %s", tt.name)
+		assert.Equal(t, tt.expected, result, "when %s", tt.name)
+	}
+}
+
+func Test_ResolveWatchNamespaces_InvalidSelector(t *testing.T) {
+	_, err := ResolveWatchNamespaces(context.Background(), nil, nil, "!!")
+
+	assert.Error(t, err)
+}
@@ -4,25 +4,60 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"riser-controller/pkg/api"
+	"riser-controller/pkg/environment"
+	"riser-controller/pkg/heartbeat"
+	"riser-controller/pkg/ping"
 	"riser-controller/pkg/runtime"
 	"riser-controller/pkg/status"
+	"riser-controller/pkg/util"
+	"strings"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 
 	"github.com/pkg/errors"
 
 	"github.com/riser-platform/riser-server/api/v1/model"
 
 	"github.com/go-logr/logr"
-	"github.com/riser-platform/riser-server/pkg/sdk"
+	"k8s.io/apimachinery/pkg/api/equality"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"knative.dev/serving/pkg/apis/serving"
 	knserving "knative.dev/serving/pkg/apis/serving/v1"
+	knservingv1beta1 "knative.dev/serving/pkg/apis/serving/v1beta1"
+	"knative.dev/serving/pkg/gc"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
+// sealedSecretGVK is the bitnami SealedSecret. Sealed secrets are read as unstructured objects to avoid a dependency on the sealed secrets module.
+var sealedSecretGVK = schema.GroupVersionKind{Group: "bitnami.com", Version: "v1alpha1", Kind: "SealedSecret"}
+
+const (
+	// statusConflictRequeueDelay is the delay before reconciling again when the riser server has a status for a newer riser revision
+	statusConflictRequeueDelay = 30 * time.Second
+	// statusConflictQueueSize is the number of batched status conflicts that can be waiting to be requeued
+	statusConflictQueueSize = 100
+)
+
+// revisionOwnerUIDField is the cache index for the UID of the Configuration that controls a Revision
+const revisionOwnerUIDField = ".metadata.controller.uid"
+
 type KNativeConfigurationReconciler struct {
 	KNativeReconciler
 }
@@ -33,9 +68,27 @@ type KNativeRouteReconciler struct {
 
 type KNativeReconciler struct {
 	client.Client
+	// APIReader reads pods directly from the API server so that every pod in the cluster is not cached
+	APIReader   client.Reader
 	Log         logr.Logger
 	Config      runtime.Config
-	RiserClient *sdk.Client
+	RiserClient *api.Client
+	// Heartbeat tracks the last successful reconcile for the pinger. Optional.
+	Heartbeat *heartbeat.Tracker
+	// Registration reports when each environment is registered with the riser server. Statuses are buffered in StatusBuffer until then.
+	// Optional: when nil every environment is assumed to be registered.
+	Registration *ping.Registration
+	StatusBuffer *StatusBuffer
+	// StatusBatcher saves statuses in batches. Optional: when nil each status is saved as soon as it's reconciled.
+	StatusBatcher *StatusBatcher
+	// Recorder records events for the reconciled Configuration. Optional.
+	Recorder record.EventRecorder
+	// Environments maps each namespace to its riser environment. Optional: when nil every namespace belongs to Config.Environment.
+	Environments *environment.Resolver
+	// Reported tracks the deployments reported by the controller so that their removal can be reported. Must be shared by the Configuration
+	// and Route reconcilers. Optional: when nil removals are not reported.
+	Reported *ReportedDeployments
+	Options  ReconcileOptions
 }
 
 // SetupWithManager functions for each type that we want to reconcile
@@ -45,18 +98,164 @@ type KNativeReconciler struct {
 // - Use a knative Service: this is problematic with the gitops pattern because the lifecycles are different for each resource
 // - Keep doing what we're doing if there's no practical side effects (<- likely the right answer)
 func (r *KNativeConfigurationReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	controllerBuilder := ctrl.NewControllerManagedBy(mgr).
 		For(&knserving.Configuration{}).
-		WithEventFilter(createUpdateRiserFilter()).
-		Owns(&appsv1.Deployment{}).
-		Complete(r)
+		WithOptions(r.Options.controllerOptions()).
+		WithEventFilter(riserFilter()).
+		// Deployments are owned by the revision rather than the Configuration. Only the metadata is needed to map a Deployment to its
+		// Configuration.
+		Watches(&source.Kind{Type: &appsv1.Deployment{}}, handler.EnqueueRequestsFromMapFunc(mapToConfiguration), builder.OnlyMetadata).
+		// Revision conditions (e.g. ContainerHealthy) can change long after the Configuration was last updated. The revision's ready replicas
+		// also change whenever the readiness of its pods changes, so pods don't need to be watched (see getPods).
+		Watches(&source.Kind{Type: &knserving.Revision{}}, handler.EnqueueRequestsFromMapFunc(mapRevisionToConfiguration))
+	if r.Config.SealedSecretEnabled {
+		// Watching a kind that is not installed fails the manager on startup
+		installed, err := isInstalled(mgr.GetRESTMapper(), sealedSecretGVK)
+		if err != nil {
+			return err
+		}
+		if installed {
+			controllerBuilder = controllerBuilder.Watches(&source.Kind{Type: newSealedSecret()}, handler.EnqueueRequestsFromMapFunc(r.mapSealedSecretToConfigurations))
+		} else {
+			r.Log.Info("The SealedSecret CRD is not installed. Sealed secret statuses will not be reported until the controller is restarted after it is installed.")
+		}
+	}
+	if r.StatusBatcher != nil {
+		// Batched statuses are saved outside of the reconcile, so conflicts are requeued through a channel
+		conflicts := make(chan event.GenericEvent, statusConflictQueueSize)
+		r.StatusBatcher.OnConflict(r.batchedStatusConflictFunc(conflicts))
+		r.StatusBatcher.OnRemovalUnsupported(func() { r.disableRemovalReporting(r.Log) })
+		controllerBuilder = controllerBuilder.Watches(&source.Channel{Source: conflicts}, requeueAfter(statusConflictRequeueDelay))
+	}
+	return controllerBuilder.Complete(r)
+}
+
+// batchedStatusConflictFunc handles a conflict from the StatusBatcher the same way as a conflict from a direct save. The Configuration is sent
+// to the conflicts channel when it should be reconciled again.
+func (r *KNativeConfigurationReconciler) batchedStatusConflictFunc(conflicts chan<- event.GenericEvent) statusConflictFunc {
+	return func(name types.NamespacedName, observedRiserRevision int64, err error) {
+		log := r.Log.WithValues("knative", name)
+		configuration := &knserving.Configuration{}
+		getErr := r.Get(context.Background(), name, configuration)
+		if getErr != nil {
+			if !kerrors.IsNotFound(getErr) {
+				log.Error(getErr, "Error getting Configuration for status conflict")
+			}
+			return
+		}
+
+		result := r.handleDeploymentsSaveStatusConflict(log, configuration, observedRiserRevision, err)
+		if result.RequeueAfter == 0 {
+			return
+		}
+		select {
+		case conflicts <- event.GenericEvent{Object: configuration}:
+		default:
+			log.Info("Too many status conflicts waiting to be retried. The deployment will be retried on the next change or resync")
+		}
+	}
+}
+
+// requeueAfter enqueues the object of each generic event after the delay
+func requeueAfter(delay time.Duration) handler.EventHandler {
+	return handler.Funcs{
+		GenericFunc: func(evt event.GenericEvent, q workqueue.RateLimitingInterface) {
+			q.AddAfter(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(evt.Object)}, delay)
+		},
+	}
+}
+
+// mapSealedSecretToConfigurations maps a sealed secret to every Configuration for the same riser app
+func (r *KNativeConfigurationReconciler) mapSealedSecretToConfigurations(obj client.Object) []reconcile.Request {
+	configurationList := &knserving.ConfigurationList{}
+	err := r.List(context.Background(), configurationList, client.InNamespace(obj.GetNamespace()), client.MatchingLabels{riserLabel("app"): obj.GetLabels()[riserLabel("app")]})
+	if err != nil {
+		r.Log.Error(err, "Unable to list configurations for sealed secret", "name", obj.GetName(), "namespace", obj.GetNamespace())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, len(configurationList.Items))
+	for idx, configuration := range configurationList.Items {
+		requests[idx] = reconcile.Request{NamespacedName: types.NamespacedName{Namespace: configuration.Namespace, Name: configuration.Name}}
+	}
+	return requests
+}
+
+// isInstalled returns true if the API server serves the kind (e.g. its CRD is installed)
+func isInstalled(mapper meta.RESTMapper, gvk schema.GroupVersionKind) (bool, error) {
+	_, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, fmt.Sprintf("Unable to determine if %s is installed", gvk.Kind))
+	}
+	return true, nil
+}
+
+func newSealedSecret() *unstructured.Unstructured {
+	sealedSecret := &unstructured.Unstructured{}
+	sealedSecret.SetGroupVersionKind(sealedSecretGVK)
+	return sealedSecret
+}
+
+// mapRevisionToConfiguration maps a revision to the Configuration that controls it
+func mapRevisionToConfiguration(obj client.Object) []reconcile.Request {
+	owner := metav1.GetControllerOf(obj)
+	if !isConfigurationOwner(owner) {
+		return nil
+	}
+	return []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: owner.Name}},
+	}
+}
+
+// mapToConfiguration maps an object that knative labels with its Configuration (e.g. a revision's Deployment) to the Configuration
+func mapToConfiguration(obj client.Object) []reconcile.Request {
+	configurationName := obj.GetLabels()[serving.ConfigurationLabelKey]
+	if configurationName == "" {
+		return nil
+	}
+	return []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: configurationName}},
+	}
 }
 
 func (r *KNativeRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&knserving.Route{}).
-		WithEventFilter(createUpdateRiserFilter()).
-		Complete(r)
+	controllerBuilder := ctrl.NewControllerManagedBy(mgr).
+		For(&knserving.Route{}, builder.WithPredicates(riserFilter())).
+		WithOptions(r.Options.controllerOptions())
+	if r.Config.DomainMappingEnabled {
+		// Domain mappings are not labelled by riser so they are filtered by the route that they reference
+		controllerBuilder = controllerBuilder.Watches(&source.Kind{Type: &knservingv1beta1.DomainMapping{}}, handler.EnqueueRequestsFromMapFunc(r.mapDomainMappingToRoute))
+	}
+	return controllerBuilder.Complete(r)
+}
+
+// mapDomainMappingToRoute maps a domain mapping to the riser route (or knative service) that it references. Domain mappings that reference
+// anything else, or a route that is not cached (e.g. in a namespace that is not watched), are ignored.
+func (r *KNativeRouteReconciler) mapDomainMappingToRoute(obj client.Object) []reconcile.Request {
+	domainMapping, ok := obj.(*knservingv1beta1.DomainMapping)
+	if !ok {
+		return nil
+	}
+	name, ok := status.GetDomainMappingRoute(domainMapping)
+	if !ok {
+		return nil
+	}
+
+	route := &knserving.Route{}
+	err := r.Get(context.Background(), name, route)
+	if err != nil {
+		if !kerrors.IsNotFound(err) {
+			r.Log.V(1).Info("Unable to get the route referenced by a domain mapping", "domainMapping", client.ObjectKeyFromObject(obj), "error", err.Error())
+		}
+		return nil
+	}
+	if _, ok := route.Labels[riserLabel("app")]; !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: name}}
 }
 
 func (r *KNativeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -67,20 +266,43 @@ func (r *KNativeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	err := r.Get(ctx, req.NamespacedName, configuration)
 	if err != nil {
 		if kerrors.IsNotFound(err) {
-			log.Info("Configuration not found")
-			return ctrl.Result{}, nil
+			// The environment that the deployment was reported to is used since the namespace may have been deleted
+			reportedEnvironmentName, reported := r.Reported.Remove(req.NamespacedName)
+			if !reported {
+				log.Info("Configuration not found")
+				return ctrl.Result{}, nil
+			}
+			log.Info("Configuration deleted. Reporting deployment removal...", "environment", reportedEnvironmentName)
+			return r.reportRemoval(log.WithValues("environment", reportedEnvironmentName), req.NamespacedName, reportedEnvironmentName)
 		}
 		log.Error(err, "Unable to get knative configuration")
 		return ctrl.Result{}, err
 	}
 
-	revisions, err := r.getRevisions(configuration)
+	environmentName, err := r.getEnvironment(ctx, req.Namespace)
+	if err != nil {
+		log.Error(err, "Unable to determine environment")
+		return ctrl.Result{}, err
+	}
+	if environmentName == "" {
+		log.V(1).Info("Namespace belongs to an environment that is not managed by this controller")
+		return ctrl.Result{}, nil
+	}
+	log = log.WithValues("environment", environmentName)
+
+	revisions, staleRevisions, err := r.getRevisions(configuration)
 	if err != nil {
 		if !kerrors.IsNotFound(err) {
 			return ctrl.Result{}, err
 		}
 	}
 
+	pods, err := r.getPods(configuration)
+	if err != nil {
+		log.Error(err, "Unable to get pods")
+		return ctrl.Result{}, err
+	}
+
 	route := &knserving.Route{}
 	err = r.Get(ctx, req.NamespacedName, route)
 	if err != nil {
@@ -92,23 +314,120 @@ func (r *KNativeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		return ctrl.Result{}, err
 	}
 
-	status, err := createStatusFromKnative(configuration, route, revisions)
+	gcTimes := map[string]time.Time{}
+	if r.Config.RevisionGcReportEnabled {
+		gcConfig, err := r.getGCConfig(ctx)
+		if err != nil {
+			log.Error(err, "Unable to get knative garbage collection config")
+			return ctrl.Result{}, err
+		}
+		gcTimes = status.GetGarbageCollectionTimes(gcConfig, configuration, revisions, time.Now())
+	}
+
+	domainMappings, err := r.getDomainMappings(route)
+	if err != nil {
+		log.Error(err, "Unable to get domain mappings")
+		return ctrl.Result{}, err
+	}
+
+	riserStatus, err := createStatusFromKnative(configuration, route, revisions, staleRevisions, pods)
 	if err != nil {
 		log.Error(err, "Unable to determine configuration status")
 		return ctrl.Result{}, err
 	}
 
-	statusCode, err := r.RiserClient.Deployments.SaveStatus(req.Name, req.Namespace, r.Config.Environment, status)
-	return r.handleDeploymentsSaveStatusResult(log, status.ObservedRiserRevision, statusCode, err)
+	riserStatus.Configuration = status.GetConfigurationStatus(configuration)
+	riserStatus.Route = status.GetRouteStatus(route, domainMappings)
+	if r.Config.SealedSecretEnabled {
+		sealedSecrets, err := r.getSealedSecrets(configuration)
+		if err != nil {
+			log.Error(err, "Unable to get sealed secrets")
+			return ctrl.Result{}, err
+		}
+		riserStatus.Secrets = status.GetSecretStatuses(sealedSecrets)
+	}
+	markGarbageCollection(riserStatus, gcTimes)
+	applyRevisionRetention(riserStatus, route, r.Config.RevisionStatusLimit)
+
+	for _, revision := range append(riserStatus.Revisions, riserStatus.StaleRevisions...) {
+		if revision.DockerImage == "" {
+			log.Info("Unable to identify the primary container for revision", "revision", revision.Name)
+		}
+	}
+
+	r.Reported.Add(req.NamespacedName, environmentName)
+	if !r.Registration.IsRegistered(environmentName) && r.StatusBuffer.Add(req.NamespacedName, environmentName, riserStatus) {
+		log.Info("Environment not yet registered. Buffering deployment status", "observedRiserRevision", riserStatus.ObservedRiserRevision)
+		return ctrl.Result{}, nil
+	}
+
+	if r.StatusBuffer.AddIfBuffered(req.NamespacedName, environmentName, riserStatus) {
+		log.Info("A buffered deployment status is being saved. Buffering deployment status", "observedRiserRevision", riserStatus.ObservedRiserRevision)
+		return ctrl.Result{}, nil
+	}
+	if r.StatusBatcher != nil {
+		log.V(1).Info("Batching deployment status", "observedRiserRevision", riserStatus.ObservedRiserRevision)
+		r.StatusBatcher.Add(req.NamespacedName, environmentName, riserStatus)
+		return ctrl.Result{}, nil
+	}
+	statusCode, err := api.SaveDeploymentStatus(r.RiserClient, req.Name, req.Namespace, environmentName, riserStatus)
+	return r.handleDeploymentsSaveStatusResult(log, configuration, riserStatus.ObservedRiserRevision, statusCode, err)
 }
 
-func (r *KNativeReconciler) handleDeploymentsSaveStatusResult(log logr.Logger, observedRiserRevision int64, statusCode int, err error) (ctrl.Result, error) {
+// reportRemoval reports that a deployment reported by the controller was removed. The removal is buffered when the environment is not yet
+// registered.
+func (r *KNativeReconciler) reportRemoval(log logr.Logger, name types.NamespacedName, environmentName string) (ctrl.Result, error) {
+	if !r.Registration.IsRegistered(environmentName) && r.StatusBuffer.Add(name, environmentName, nil) {
+		log.Info("Environment not yet registered. Buffering deployment removal")
+		return ctrl.Result{}, nil
+	}
+
+	if r.StatusBuffer.AddIfBuffered(name, environmentName, nil) {
+		log.Info("A buffered deployment status is being saved. Buffering deployment removal")
+		return ctrl.Result{}, nil
+	}
+	if r.StatusBatcher != nil {
+		log.V(1).Info("Batching deployment removal")
+		r.StatusBatcher.Add(name, environmentName, nil)
+		return ctrl.Result{}, nil
+	}
+	statusCode, err := api.DeleteDeploymentStatus(r.RiserClient, name.Name, name.Namespace, environmentName)
+	if isUnsupported(statusCode) {
+		r.disableRemovalReporting(log)
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		log.Error(err, "Error reporting deployment removal")
+		// Track the deployment again so that the removal is retried
+		r.Reported.Add(name, environmentName)
+		return ctrl.Result{Requeue: true}, err
+	}
+	log.Info("Reported deployment removal")
+	return ctrl.Result{}, nil
+}
+
+// disableRemovalReporting stops tracking deployments for removal since the riser server doesn't support reporting removals
+func (r *KNativeReconciler) disableRemovalReporting(log logr.Logger) {
+	if r.Reported.Disable() {
+		log.Info("The riser server does not support reporting deployment removals. Removals will not be reported.")
+	}
+}
+
+// getEnvironment returns the environment for the namespace or an empty string if the environment is not managed by this controller
+func (r *KNativeReconciler) getEnvironment(ctx context.Context, namespace string) (string, error) {
+	if r.Environments == nil {
+		return r.Config.Environment, nil
+	}
+	return r.Environments.ForNamespace(ctx, namespace)
+}
+
+func (r *KNativeReconciler) handleDeploymentsSaveStatusResult(log logr.Logger, configuration client.Object, observedRiserRevision int64, statusCode int, err error) (ctrl.Result, error) {
 	if err == nil {
 		log.Info("Saved deployment status", "observedRiserRevision", observedRiserRevision)
+		r.Heartbeat.ReconcileSucceeded()
 	} else {
 		if statusCode == http.StatusConflict {
-			log.Error(err, "Error saving deployment status: conflict", "observedRiserRevision", observedRiserRevision)
-			return ctrl.Result{}, nil
+			return r.handleDeploymentsSaveStatusConflict(log, configuration, observedRiserRevision, err), nil
 		}
 		log.Error(err, "Error saving deployment status", "observedRiserRevision", observedRiserRevision)
 		return ctrl.Result{Requeue: true}, err
@@ -116,36 +435,198 @@ func (r *KNativeReconciler) handleDeploymentsSaveStatusResult(log logr.Logger, o
 	return ctrl.Result{}, nil
 }
 
-func (r *KNativeReconciler) getRevisions(kcfg *knserving.Configuration) ([]knserving.Revision, error) {
+/*
+handleDeploymentsSaveStatusConflict handles the server rejecting a status because it already has a status for a newer riser revision. During fast
+deploys the Configuration may not yet have been updated in the cluster (or the cache), so the deployment is reconciled again after a delay. The
+status is dropped when the server does not include its observed riser revision (e.g. older servers) or its revision is not newer.
+*/
+func (r *KNativeReconciler) handleDeploymentsSaveStatusConflict(log logr.Logger, configuration client.Object, observedRiserRevision int64, err error) ctrl.Result {
+	serverRiserRevision := int64(0)
+	clientErr := &api.ClientError{}
+	if errors.As(err, &clientErr) {
+		serverRiserRevision = clientErr.ObservedRiserRevision
+	}
+
+	log.Error(err, "Error saving deployment status: conflict", "observedRiserRevision", observedRiserRevision, "serverObservedRiserRevision", serverRiserRevision)
+	if r.Recorder != nil {
+		r.Recorder.Eventf(configuration, corev1.EventTypeWarning, "StatusConflict",
+			"The riser server rejected the status for riser revision %d. The server has the status for riser revision %d.", observedRiserRevision, serverRiserRevision)
+	}
+
+	if serverRiserRevision > observedRiserRevision {
+		log.Info("The cluster may not have caught up with the riser server. Retrying...", "after", statusConflictRequeueDelay)
+		return ctrl.Result{RequeueAfter: statusConflictRequeueDelay}
+	}
+	return ctrl.Result{}
+}
+
+// SetupFieldIndexes registers the cache indexes required by the reconcilers. This must be called once before the reconcilers are started.
+func SetupFieldIndexes(ctx context.Context, mgr ctrl.Manager) error {
+	return mgr.GetFieldIndexer().IndexField(ctx, &knserving.Revision{}, revisionOwnerUIDField, indexRevisionOwnerUID)
+}
+
+// indexRevisionOwnerUID indexes a revision by the UID of its controlling knative Configuration
+func indexRevisionOwnerUID(obj client.Object) []string {
+	owner := metav1.GetControllerOf(obj)
+	if !isConfigurationOwner(owner) {
+		return nil
+	}
+	return []string{string(owner.UID)}
+}
+
+func isConfigurationOwner(owner *metav1.OwnerReference) bool {
+	if owner == nil || owner.Kind != "Configuration" {
+		return false
+	}
+	gv, err := schema.ParseGroupVersion(owner.APIVersion)
+	return err == nil && gv.Group == serving.GroupName
+}
+
+// getRevisions returns the revisions owned by the configuration along with any stale revisions. Stale revisions are owned by a previous
+// Configuration with the same name (e.g. the deployment was deleted and recreated) and have not yet been garbage collected.
+func (r *KNativeReconciler) getRevisions(kcfg *knserving.Configuration) (revisions []knserving.Revision, staleRevisions []knserving.Revision, err error) {
 	revisionList := &knserving.RevisionList{}
-	// Filtering on app label works but ownerReference is probably the more correct approach.
-	// Couldn't quickly find how to do that so sticking with the label filter for now.
-	err := r.List(context.Background(), revisionList, client.InNamespace(kcfg.Namespace), riserAppFilter(kcfg.ObjectMeta))
+	err = r.List(context.Background(), revisionList, client.InNamespace(kcfg.Namespace), client.MatchingFields{revisionOwnerUIDField: string(kcfg.UID)})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error listing revisions")
+	}
+
+	staleRevisionList := &knserving.RevisionList{}
+	err = r.List(context.Background(), staleRevisionList, client.InNamespace(kcfg.Namespace), client.MatchingLabels{serving.ConfigurationLabelKey: kcfg.Name})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error listing stale revisions")
+	}
+
+	return revisionList.Items, filterStaleRevisions(kcfg, staleRevisionList.Items), nil
+}
+
+// filterStaleRevisions returns revisions owned by a Configuration with the same name but a different UID. Revisions without a
+// Configuration owner (e.g. hand-labelled) are excluded.
+func filterStaleRevisions(kcfg *knserving.Configuration, revisions []knserving.Revision) []knserving.Revision {
+	stale := []knserving.Revision{}
+	for _, revision := range revisions {
+		owner := metav1.GetControllerOf(&revision)
+		if isConfigurationOwner(owner) && owner.Name == kcfg.Name && owner.UID != kcfg.UID {
+			stale = append(stale, revision)
+		}
+	}
+	return stale
+}
+
+// getGCConfig returns the knative revision garbage collection config. The knative defaults are returned if the config does not exist.
+func (r *KNativeReconciler) getGCConfig(ctx context.Context) (*gc.Config, error) {
+	cm := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: util.KNativeServingNamespace, Name: gc.ConfigName}, cm)
+	if err != nil && !kerrors.IsNotFound(err) {
+		return nil, errors.Wrap(err, "error getting knative gc config")
+	}
+
+	return gc.NewConfigFromConfigMapFunc(ctx)(cm)
+}
+
+// getDomainMappings returns all domain mappings in the route's namespace. Domain mappings are optional in knative so an empty list is
+// returned when domain mappings are disabled or not installed.
+func (r *KNativeReconciler) getDomainMappings(route *knserving.Route) ([]knservingv1beta1.DomainMapping, error) {
+	if !r.Config.DomainMappingEnabled {
+		return nil, nil
+	}
+	domainMappingList := &knservingv1beta1.DomainMappingList{}
+	err := r.List(context.Background(), domainMappingList, client.InNamespace(route.Namespace))
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error listing domain mappings")
+	}
+
+	return domainMappingList.Items, nil
+}
+
+// getSealedSecrets returns the sealed secrets for the configuration's riser app
+func (r *KNativeReconciler) getSealedSecrets(kcfg *knserving.Configuration) ([]unstructured.Unstructured, error) {
+	sealedSecretList := &unstructured.UnstructuredList{}
+	sealedSecretList.SetGroupVersionKind(sealedSecretGVK.GroupVersion().WithKind(sealedSecretGVK.Kind + "List"))
+	err := r.List(context.Background(), sealedSecretList, client.InNamespace(kcfg.Namespace), client.MatchingLabels{riserLabel("app"): kcfg.Labels[riserLabel("app")]})
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error listing sealed secrets")
+	}
+
+	return sealedSecretList.Items, nil
+}
+
+// getPods returns all pods for all revisions of the configuration. Pods are not cached, so they are listed from the API server.
+func (r *KNativeReconciler) getPods(kcfg *knserving.Configuration) ([]corev1.Pod, error) {
+	podList := &corev1.PodList{}
+	err := r.APIReader.List(context.Background(), podList, client.InNamespace(kcfg.Namespace), client.MatchingLabels{serving.ConfigurationLabelKey: kcfg.Name})
 	if err != nil {
-		return nil, errors.Wrap(err, "error listing revisions")
+		return nil, errors.Wrap(err, "error listing pods")
 	}
 
-	return revisionList.Items, nil
+	return podList.Items, nil
 }
 
-func createStatusFromKnative(kcfg *knserving.Configuration, route *knserving.Route, revisions []knserving.Revision) (*model.DeploymentStatusMutable, error) {
+func createStatusFromKnative(kcfg *knserving.Configuration, route *knserving.Route, revisions []knserving.Revision, staleRevisions []knserving.Revision, pods []corev1.Pod) (*api.DeploymentStatus, error) {
 	// TODO: check route revision and warn when there's a conflict, or consider not updating status at all
 	observedRiserRevision, err := getRiserRevision(kcfg.ObjectMeta)
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf("Error getting riser revision for knative configuration %q", kcfg.Name))
 	}
 
-	riserStatus := &model.DeploymentStatusMutable{
-		ObservedRiserRevision:     observedRiserRevision,
-		LatestCreatedRevisionName: kcfg.Status.LatestCreatedRevisionName,
-		LatestReadyRevisionName:   kcfg.Status.LatestReadyRevisionName,
+	riserStatus := &api.DeploymentStatus{
+		DeploymentStatusMutable: model.DeploymentStatusMutable{
+			ObservedRiserRevision:     observedRiserRevision,
+			LatestCreatedRevisionName: kcfg.Status.LatestCreatedRevisionName,
+			LatestReadyRevisionName:   kcfg.Status.LatestReadyRevisionName,
+		},
 	}
 
-	riserStatus.Revisions = make([]model.DeploymentRevisionStatus, len(revisions))
-	for idx, revision := range revisions {
-		dockerImage, err := getAppDockerImageFromKnativeRevision(&revision)
+	podsByRevision := map[string][]corev1.Pod{}
+	for _, pod := range pods {
+		revisionName := pod.Labels[serving.RevisionLabelKey]
+		podsByRevision[revisionName] = append(podsByRevision[revisionName], pod)
+	}
+
+	riserStatus.Revisions, err = createRevisionStatuses(revisions, podsByRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(staleRevisions) > 0 {
+		riserStatus.StaleRevisions, err = createRevisionStatuses(staleRevisions, podsByRevision)
 		if err != nil {
-			return nil, errors.Wrap(err, "Unable to get docker image")
+			return nil, err
+		}
+	}
+
+	riserStatus.Traffic = make([]api.DeploymentTrafficStatus, len(route.Status.Traffic))
+	for idx, traffic := range route.Status.Traffic {
+		riserStatus.Traffic[idx] = api.DeploymentTrafficStatus{
+			DeploymentTrafficStatus: model.DeploymentTrafficStatus{
+				RevisionName: traffic.RevisionName,
+				Percent:      traffic.Percent,
+				Tag:          traffic.Tag,
+			},
+		}
+		if traffic.URL != nil {
+			riserStatus.Traffic[idx].URL = traffic.URL.String()
+		}
+	}
+	return riserStatus, nil
+}
+
+func createRevisionStatuses(revisions []knserving.Revision, podsByRevision map[string][]corev1.Pod) ([]api.DeploymentRevisionStatus, error) {
+	revisionStatuses := make([]api.DeploymentRevisionStatus, len(revisions))
+	for idx, revision := range revisions {
+		containers := status.GetContainerStatuses(&revision, getPrimaryContainerName(&revision), podsByRevision[revision.Name])
+		// The docker image is left empty rather than failing the entire status when the primary container can't be identified
+		dockerImage := ""
+		for _, container := range containers {
+			if container.Primary {
+				dockerImage = container.Image
+			}
 		}
 		revisionGen, err := getRiserRevision(revision.ObjectMeta)
 		if err != nil {
@@ -154,43 +635,79 @@ func createStatusFromKnative(kcfg *knserving.Configuration, route *knserving.Rou
 
 		revisionStatus := status.GetRevisionStatus(&revision)
 
-		riserStatus.Revisions[idx] = model.DeploymentRevisionStatus{
-			Name:                 revision.Name,
-			DockerImage:          dockerImage,
-			RiserRevision:        revisionGen,
-			RevisionStatus:       revisionStatus.Status,
-			RevisionStatusReason: revisionStatus.Reason,
+		revisionStatuses[idx] = api.DeploymentRevisionStatus{
+			DeploymentRevisionStatus: model.DeploymentRevisionStatus{
+				Name:                 revision.Name,
+				DockerImage:          dockerImage,
+				RiserRevision:        revisionGen,
+				RevisionStatus:       revisionStatus.Status,
+				RevisionStatusReason: revisionStatus.Reason,
+			},
+			Containers: containers,
 		}
 	}
-
-	riserStatus.Traffic = make([]model.DeploymentTrafficStatus, len(route.Status.Traffic))
-	for idx, traffic := range route.Status.Traffic {
-		riserStatus.Traffic[idx] = model.DeploymentTrafficStatus{
-			RevisionName: traffic.RevisionName,
-			Percent:      traffic.Percent,
-			Tag:          traffic.Tag,
-		}
-	}
-	return riserStatus, nil
+	return revisionStatuses, nil
 }
 
-func getAppDockerImageFromKnativeRevision(revision *knserving.Revision) (string, error) {
+// getPrimaryContainerName returns the name of the container running the riser app. The app container is named after the deployment. If there
+// is no such container and the revision only has a single container, that container is assumed to be the app. Returns an empty string if the
+// primary container can't be identified.
+func getPrimaryContainerName(revision *knserving.Revision) string {
 	riserDeployment := revision.Labels[riserLabel("deployment")]
 	for _, container := range revision.Spec.Containers {
 		if container.Name == riserDeployment {
-			return container.Image, nil
+			return container.Name
+		}
+	}
+	if len(revision.Spec.Containers) == 1 {
+		return revision.Spec.Containers[0].Name
+	}
+	return ""
+}
+
+// riserFilter only passes events for riser apps. Deletes are passed so that the removal of a deployment is reported. Updates are only passed
+// when they may change the deployment status (see hasStatusRelevantChange) since other controllers frequently update metadata.
+func riserFilter() predicate.Funcs {
+	filter := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return isRiserApp(obj)
+	})
+	filter.UpdateFunc = func(evt event.UpdateEvent) bool {
+		return isRiserApp(evt.ObjectNew) && hasStatusRelevantChange(evt.ObjectOld, evt.ObjectNew)
+	}
+	return filter
+}
+
+// hasStatusRelevantChange returns true if the generation (i.e. the spec), the status (conditions, traffic, etc.) or any riser label or annotation
+// changed. Only the metadata is compared for other types (e.g. metadata only Deployments).
+func hasStatusRelevantChange(oldObj, newObj client.Object) bool {
+	return oldObj.GetGeneration() != newObj.GetGeneration() ||
+		!equality.Semantic.DeepEqual(getRiserMetadata(oldObj.GetLabels()), getRiserMetadata(newObj.GetLabels())) ||
+		!equality.Semantic.DeepEqual(getRiserMetadata(oldObj.GetAnnotations()), getRiserMetadata(newObj.GetAnnotations())) ||
+		!equality.Semantic.DeepEqual(getStatus(oldObj), getStatus(newObj))
+}
+
+// getRiserMetadata returns the riser labels or annotations
+func getRiserMetadata(metadata map[string]string) map[string]string {
+	riserMetadata := map[string]string{}
+	for key, value := range metadata {
+		if strings.HasPrefix(key, riserLabel("")) {
+			riserMetadata[key] = value
 		}
 	}
-	return "", fmt.Errorf("Unable to find a container matching the deployment %q", riserDeployment)
+	return riserMetadata
 }
 
-func createUpdateRiserFilter() predicate.Funcs {
-	return predicate.Funcs{
-		CreateFunc: func(evt event.CreateEvent) bool {
-			return isRiserApp(evt.Object)
-		},
-		UpdateFunc: func(evt event.UpdateEvent) bool {
-			return isRiserApp(evt.ObjectNew)
-		},
+// getStatus returns the status of a knative object or sealed secret. Returns nil for other types.
+func getStatus(obj client.Object) interface{} {
+	switch typed := obj.(type) {
+	case *knserving.Configuration:
+		return typed.Status
+	case *knserving.Route:
+		return typed.Status
+	case *knserving.Revision:
+		return typed.Status
+	case *unstructured.Unstructured:
+		return typed.Object["status"]
 	}
+	return nil
 }
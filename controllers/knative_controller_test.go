@@ -1,19 +1,40 @@
 package controllers
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"riser-controller/pkg/api"
+	riserruntime "riser-controller/pkg/runtime"
 	"riser-controller/pkg/util"
 	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/riser-platform/riser-server/pkg/sdk"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	"github.com/stretchr/testify/require"
 	corea1 "k8s.io/api/core/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/stretchr/testify/assert"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
 	knserving "knative.dev/serving/pkg/apis/serving/v1"
+	knservingv1beta1 "knative.dev/serving/pkg/apis/serving/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 func Test_createStatusFromKnative(t *testing.T) {
@@ -44,6 +65,7 @@ func Test_createStatusFromKnative(t *testing.T) {
 						RevisionName: "rev1",
 						Percent:      util.PtrInt64(10),
 						Tag:          "r1",
+						URL:          &apis.URL{Scheme: "https", Host: "r1-mydep.myns.example.com"},
 					},
 				},
 			},
@@ -96,7 +118,23 @@ func Test_createStatusFromKnative(t *testing.T) {
 		},
 	}
 
-	result, err := createStatusFromKnative(cfg, route, revisions)
+	pods := []corea1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{
+					"serving.knative.dev/revision": "rev1",
+				},
+			},
+			Status: corea1.PodStatus{
+				ContainerStatuses: []corea1.ContainerStatus{
+					{Name: "istio-proxy", Ready: true},
+					{Name: "mydep", Ready: true},
+				},
+			},
+		},
+	}
+
+	result, err := createStatusFromKnative(cfg, route, revisions, nil, pods)
 
 	require.NoError(t, err)
 	assert.Equal(t, int64(1), result.ObservedRiserRevision)
@@ -112,14 +150,288 @@ func Test_createStatusFromKnative(t *testing.T) {
 	assert.Equal(t, "my/image:0.0.2", result.Revisions[1].DockerImage)
 	assert.Equal(t, int64(1), result.Revisions[1].RiserRevision)
 
+	// Containers
+	require.Len(t, result.Revisions[0].Containers, 2)
+	assert.Equal(t, "mydep", result.Revisions[0].Containers[0].Name)
+	assert.True(t, result.Revisions[0].Containers[0].Primary)
+	assert.Nil(t, result.Revisions[0].Containers[0].Ready)
+	assert.Equal(t, "istio-proxy", result.Revisions[0].Containers[1].Name)
+	assert.False(t, result.Revisions[0].Containers[1].Primary)
+	require.Len(t, result.Revisions[1].Containers, 2)
+	assert.Equal(t, "istio-proxy", result.Revisions[1].Containers[0].Name)
+	assert.False(t, result.Revisions[1].Containers[0].Primary)
+	assert.Equal(t, util.PtrBool(true), result.Revisions[1].Containers[0].Ready)
+	assert.Equal(t, "mydep", result.Revisions[1].Containers[1].Name)
+	assert.True(t, result.Revisions[1].Containers[1].Primary)
+	assert.Equal(t, util.PtrBool(true), result.Revisions[1].Containers[1].Ready)
+	assert.Empty(t, result.StaleRevisions)
+
 	// Traffic
 	require.Len(t, result.Traffic, 2)
 	assert.Equal(t, "rev0", result.Traffic[0].RevisionName)
 	assert.Equal(t, int64(90), *result.Traffic[0].Percent)
 	assert.Equal(t, "r0", result.Traffic[0].Tag)
+	assert.Empty(t, result.Traffic[0].URL)
 	assert.Equal(t, "rev1", result.Traffic[1].RevisionName)
 	assert.Equal(t, int64(10), *result.Traffic[1].Percent)
 	assert.Equal(t, "r1", result.Traffic[1].Tag)
+	assert.Equal(t, "https://r1-mydep.myns.example.com", result.Traffic[1].URL)
+}
+
+func Test_createStatusFromKnative_WhenPrimaryContainerNotFound(t *testing.T) {
+	cfg := &knserving.Configuration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "mydep",
+			Annotations: map[string]string{
+				riserLabel("revision"): "1",
+			},
+		},
+	}
+	revisions := []knserving.Revision{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "rev1",
+				Labels: map[string]string{
+					riserLabel("deployment"): "mydep",
+				},
+				Annotations: map[string]string{
+					riserLabel("revision"): "1",
+				},
+			},
+			Spec: knserving.RevisionSpec{
+				PodSpec: corea1.PodSpec{
+					Containers: []corea1.Container{
+						{Name: "istio-proxy"},
+						{Name: "other", Image: "my/image:0.0.2"},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := createStatusFromKnative(cfg, &knserving.Route{}, revisions, nil, nil)
+
+	require.NoError(t, err)
+	require.Len(t, result.Revisions, 1)
+	assert.Empty(t, result.Revisions[0].DockerImage)
+	require.Len(t, result.Revisions[0].Containers, 2)
+	assert.False(t, result.Revisions[0].Containers[0].Primary)
+	assert.False(t, result.Revisions[0].Containers[1].Primary)
+}
+
+func Test_createStatusFromKnative_WithStaleRevisions(t *testing.T) {
+	cfg := &knserving.Configuration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "mydep",
+			Annotations: map[string]string{
+				riserLabel("revision"): "1",
+			},
+		},
+	}
+	staleRevisions := []knserving.Revision{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "rev0",
+				Annotations: map[string]string{
+					riserLabel("revision"): "5",
+				},
+			},
+			Spec: knserving.RevisionSpec{
+				PodSpec: corea1.PodSpec{
+					Containers: []corea1.Container{
+						{Name: "mydep", Image: "my/image:0.0.1"},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := createStatusFromKnative(cfg, &knserving.Route{}, []knserving.Revision{}, staleRevisions, nil)
+
+	require.NoError(t, err)
+	assert.Empty(t, result.Revisions)
+	require.Len(t, result.StaleRevisions, 1)
+	assert.Equal(t, "rev0", result.StaleRevisions[0].Name)
+	assert.Equal(t, int64(5), result.StaleRevisions[0].RiserRevision)
+	assert.Equal(t, "my/image:0.0.1", result.StaleRevisions[0].DockerImage)
+}
+
+func Test_indexRevisionOwnerUID(t *testing.T) {
+	revision := &knserving.Revision{
+		ObjectMeta: metav1.ObjectMeta{
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: "serving.knative.dev/v1",
+					Kind:       "Configuration",
+					Name:       "mydep",
+					UID:        types.UID("uid1"),
+					Controller: util.PtrBool(true),
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, []string{"uid1"}, indexRevisionOwnerUID(revision))
+}
+
+func Test_indexRevisionOwnerUID_WhenNotOwnedByConfiguration(t *testing.T) {
+	tt := []struct {
+		name  string
+		owner metav1.OwnerReference
+	}{
+		{
+			name:  "not a controller",
+			owner: metav1.OwnerReference{APIVersion: "serving.knative.dev/v1", Kind: "Configuration", UID: types.UID("uid1")},
+		},
+		{
+			name:  "different kind",
+			owner: metav1.OwnerReference{APIVersion: "serving.knative.dev/v1", Kind: "Service", UID: types.UID("uid1"), Controller: util.PtrBool(true)},
+		},
+		{
+			name:  "different group",
+			owner: metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "Configuration", UID: types.UID("uid1"), Controller: util.PtrBool(true)},
+		},
+	}
+
+	for _, test := range tt {
+		revision := &knserving.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				OwnerReferences: []metav1.OwnerReference{test.owner},
+			},
+		}
+		assert.Nil(t, indexRevisionOwnerUID(revision), "when %s", test.name)
+	}
+}
+
+func Test_mapRevisionToConfiguration(t *testing.T) {
+	revision := &knserving.Revision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mydep-00001",
+			Namespace: "myns",
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: "serving.knative.dev/v1",
+					Kind:       "Configuration",
+					Name:       "mydep",
+					UID:        types.UID("uid1"),
+					Controller: util.PtrBool(true),
+				},
+			},
+		},
+	}
+
+	result := mapRevisionToConfiguration(revision)
+
+	require.Len(t, result, 1)
+	assert.Equal(t, types.NamespacedName{Namespace: "myns", Name: "mydep"}, result[0].NamespacedName)
+}
+
+func Test_mapRevisionToConfiguration_WhenNoConfigurationOwner(t *testing.T) {
+	revision := &knserving.Revision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mydep-00001",
+			Namespace: "myns",
+		},
+	}
+
+	assert.Empty(t, mapRevisionToConfiguration(revision))
+}
+
+func Test_mapDomainMappingToRoute(t *testing.T) {
+	riserRoute := &knserving.Route{ObjectMeta: metav1.ObjectMeta{Name: "mydep", Namespace: "myns", Labels: map[string]string{"riser.dev/app": "myapp"}}}
+	otherRoute := &knserving.Route{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "myns"}}
+	reconciler := &KNativeRouteReconciler{*newTestReconciler(t, "http://localhost", riserRoute, otherRoute)}
+	newDomainMapping := func(kind, refName string) *knservingv1beta1.DomainMapping {
+		return &knservingv1beta1.DomainMapping{
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp.example.com", Namespace: "myns"},
+			Spec: knservingv1beta1.DomainMappingSpec{
+				Ref: duckv1.KReference{APIVersion: "serving.knative.dev/v1", Kind: kind, Name: refName},
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		domainMapping *knservingv1beta1.DomainMapping
+		expected      []reconcile.Request
+	}{
+		{"riser service", newDomainMapping("Service", "mydep"), []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "myns", Name: "mydep"}}}},
+		{"riser route", newDomainMapping("Route", "mydep"), []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "myns", Name: "mydep"}}}},
+		{"not a route", newDomainMapping("Configuration", "mydep"), nil},
+		{"not a riser route", newDomainMapping("Route", "other"), nil},
+		{"missing route", newDomainMapping("Route", "missing"), nil},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, reconciler.mapDomainMappingToRoute(tt.domainMapping), "when %s", tt.name)
+	}
+}
+
+func Test_filterStaleRevisions(t *testing.T) {
+	cfg := &knserving.Configuration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "mydep",
+			UID:  types.UID("current"),
+		},
+	}
+	newRevision := func(name string, owners ...metav1.OwnerReference) knserving.Revision {
+		return knserving.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				OwnerReferences: owners,
+			},
+		}
+	}
+	revisions := []knserving.Revision{
+		newRevision("current", metav1.OwnerReference{APIVersion: "serving.knative.dev/v1", Kind: "Configuration", Name: "mydep", UID: "current", Controller: util.PtrBool(true)}),
+		newRevision("stale", metav1.OwnerReference{APIVersion: "serving.knative.dev/v1", Kind: "Configuration", Name: "mydep", UID: "previous", Controller: util.PtrBool(true)}),
+		newRevision("otherconfig", metav1.OwnerReference{APIVersion: "serving.knative.dev/v1", Kind: "Configuration", Name: "other", UID: "other", Controller: util.PtrBool(true)}),
+		newRevision("handlabelled"),
+	}
+
+	result := filterStaleRevisions(cfg, revisions)
+
+	require.Len(t, result, 1)
+	assert.Equal(t, "stale", result[0].Name)
+}
+
+func Test_getPrimaryContainerName(t *testing.T) {
+	revision := &knserving.Revision{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				riserLabel("deployment"): "mydep",
+			},
+		},
+		Spec: knserving.RevisionSpec{
+			PodSpec: corea1.PodSpec{
+				Containers: []corea1.Container{
+					{Name: "istio-proxy"},
+					{Name: "mydep"},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, "mydep", getPrimaryContainerName(revision))
+}
+
+func Test_getPrimaryContainerName_WhenSingleContainer(t *testing.T) {
+	revision := &knserving.Revision{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				riserLabel("deployment"): "mydep",
+			},
+		},
+		Spec: knserving.RevisionSpec{
+			PodSpec: corea1.PodSpec{
+				Containers: []corea1.Container{
+					{Name: "user-container"},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, "user-container", getPrimaryContainerName(revision))
 }
 
 func Test_handleDeploymentsSaveStatusResult(t *testing.T) {
@@ -133,7 +445,7 @@ func Test_handleDeploymentsSaveStatusResult(t *testing.T) {
 		},
 	}
 
-	result, err := reconciler.handleDeploymentsSaveStatusResult(logger, 1, http.StatusOK, nil)
+	result, err := reconciler.handleDeploymentsSaveStatusResult(logger, &knserving.Configuration{}, 1, http.StatusOK, nil)
 
 	assert.NoError(t, err)
 	assert.Equal(t, ctrl.Result{}, result)
@@ -151,7 +463,7 @@ func Test_handleDeploymentsSaveStatusResult_RequeueOnError(t *testing.T) {
 		},
 	}
 
-	result, err := reconciler.handleDeploymentsSaveStatusResult(logger, 1, http.StatusInternalServerError, saveErr)
+	result, err := reconciler.handleDeploymentsSaveStatusResult(logger, &knserving.Configuration{}, 1, http.StatusInternalServerError, saveErr)
 
 	assert.Equal(t, err, saveErr)
 	assert.Equal(t, ctrl.Result{Requeue: true}, result)
@@ -159,19 +471,279 @@ func Test_handleDeploymentsSaveStatusResult_RequeueOnError(t *testing.T) {
 }
 
 func Test_handleDeploymentsSaveStatusResult_DoesNotRequeueOnConflict(t *testing.T) {
-	reconciler := &KNativeReconciler{}
+	recorder := record.NewFakeRecorder(1)
+	reconciler := &KNativeReconciler{Recorder: recorder}
 	saveErr := errors.New("failed")
 	logger := &FakeLogger{
 		ErrorFn: func(err error, msg string, keysAndValues ...interface{}) {
-			assert.EqualValues(t, keysAndValues[0], []interface{}{"observedRiserRevision", int64(1)})
+			assert.EqualValues(t, keysAndValues[0], []interface{}{"observedRiserRevision", int64(1), "serverObservedRiserRevision", int64(0)})
 			assert.Equal(t, saveErr, err)
 			assert.Equal(t, "Error saving deployment status: conflict", msg)
 		},
 	}
 
-	result, err := reconciler.handleDeploymentsSaveStatusResult(logger, 1, http.StatusConflict, saveErr)
+	result, err := reconciler.handleDeploymentsSaveStatusResult(logger, &knserving.Configuration{}, 1, http.StatusConflict, saveErr)
 
 	assert.NoError(t, err)
 	assert.Equal(t, ctrl.Result{}, result)
 	assert.Equal(t, 1, logger.ErrorCallCount)
+	assert.Equal(t, "Warning StatusConflict The riser server rejected the status for riser revision 1. The server has the status for riser revision 0.", <-recorder.Events)
+}
+
+func Test_handleDeploymentsSaveStatusResult_RequeueAfterOnConflictWithNewerServerRevision(t *testing.T) {
+	recorder := record.NewFakeRecorder(1)
+	reconciler := &KNativeReconciler{Recorder: recorder}
+	saveErr := &api.ClientError{ClientError: sdk.ClientError{StatusCode: http.StatusConflict}, ObservedRiserRevision: 2}
+	logger := &FakeLogger{
+		ErrorFn: func(err error, msg string, keysAndValues ...interface{}) {
+			assert.EqualValues(t, keysAndValues[0], []interface{}{"observedRiserRevision", int64(1), "serverObservedRiserRevision", int64(2)})
+			assert.Equal(t, "Error saving deployment status: conflict", msg)
+		},
+		FakeInfoLogger: FakeInfoLogger{
+			InfoFn: func(msg string, keysAndValues ...interface{}) {
+				assert.Equal(t, "The cluster may not have caught up with the riser server. Retrying...", msg)
+			},
+		},
+	}
+
+	result, err := reconciler.handleDeploymentsSaveStatusResult(logger, &knserving.Configuration{}, 1, http.StatusConflict, fmt.Errorf("wrapped: %w", saveErr))
+
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: statusConflictRequeueDelay}, result)
+	assert.Equal(t, 1, logger.ErrorCallCount)
+	assert.Equal(t, 1, logger.InfoCallCount)
+	assert.Equal(t, "Warning StatusConflict The riser server rejected the status for riser revision 1. The server has the status for riser revision 2.", <-recorder.Events)
+}
+
+func Test_batchedStatusConflictFunc_RequeuesWithBatcher(t *testing.T) {
+	name := types.NamespacedName{Name: "myapp", Namespace: "myns"}
+	configuration := &knserving.Configuration{ObjectMeta: metav1.ObjectMeta{Name: name.Name, Namespace: name.Namespace}}
+	recorder := record.NewFakeRecorder(1)
+	reconciler := &KNativeConfigurationReconciler{*newTestReconciler(t, "http://localhost", configuration)}
+	reconciler.Recorder = recorder
+	conflicts := make(chan event.GenericEvent, 1)
+
+	batcher := newTestStatusBatcher()
+	batcher.OnConflict(reconciler.batchedStatusConflictFunc(conflicts))
+	batcher.saveBatch = func(environmentName string, items []api.DeploymentStatusBatchItem) (int, error) {
+		return http.StatusConflict, errors.New("conflict")
+	}
+	batcher.save = func(name types.NamespacedName, buffered *bufferedStatus) (int, error) {
+		return http.StatusConflict, &api.ClientError{ClientError: sdk.ClientError{StatusCode: http.StatusConflict}, ObservedRiserRevision: 2}
+	}
+	batcher.Add(name, "dev", testStatus(1))
+
+	batcher.Flush()
+
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, name, client.ObjectKeyFromObject((<-conflicts).Object))
+	assert.Equal(t, "Warning StatusConflict The riser server rejected the status for riser revision 1. The server has the status for riser revision 2.", <-recorder.Events)
+	assert.Equal(t, 0, batcher.Len())
+}
+
+func Test_batchedStatusConflictFunc_DoesNotRequeueWhenServerRevisionIsNotNewer(t *testing.T) {
+	name := types.NamespacedName{Name: "myapp", Namespace: "myns"}
+	configuration := &knserving.Configuration{ObjectMeta: metav1.ObjectMeta{Name: name.Name, Namespace: name.Namespace}}
+	reconciler := &KNativeConfigurationReconciler{*newTestReconciler(t, "http://localhost", configuration)}
+	conflicts := make(chan event.GenericEvent, 1)
+
+	reconciler.batchedStatusConflictFunc(conflicts)(name, 2, &api.ClientError{ObservedRiserRevision: 2})
+	reconciler.batchedStatusConflictFunc(conflicts)(types.NamespacedName{Name: "deleted", Namespace: "myns"}, 1, &api.ClientError{ObservedRiserRevision: 2})
+
+	assert.Len(t, conflicts, 0)
+}
+
+func Test_requeueAfter(t *testing.T) {
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+	configuration := &knserving.Configuration{ObjectMeta: metav1.ObjectMeta{Name: "myapp", Namespace: "myns"}}
+
+	requeueAfter(time.Millisecond).Generic(event.GenericEvent{Object: configuration}, queue)
+
+	item, _ := queue.Get()
+	assert.Equal(t, reconcile.Request{NamespacedName: types.NamespacedName{Name: "myapp", Namespace: "myns"}}, item)
+}
+
+func Test_riserFilter(t *testing.T) {
+	riserApp := &knserving.Configuration{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"riser.dev/app": "myapp"}}}
+	other := &knserving.Configuration{}
+	filter := riserFilter()
+
+	assert.True(t, filter.Create(event.CreateEvent{Object: riserApp}))
+	assert.True(t, filter.Update(event.UpdateEvent{ObjectOld: other, ObjectNew: riserApp}))
+	assert.False(t, filter.Update(event.UpdateEvent{ObjectOld: riserApp, ObjectNew: riserApp}))
+	assert.True(t, filter.Delete(event.DeleteEvent{Object: riserApp}))
+	assert.True(t, filter.Generic(event.GenericEvent{Object: riserApp}))
+	assert.False(t, filter.Create(event.CreateEvent{Object: other}))
+	assert.False(t, filter.Update(event.UpdateEvent{ObjectOld: other, ObjectNew: other}))
+	assert.False(t, filter.Delete(event.DeleteEvent{Object: other}))
+	assert.False(t, filter.Generic(event.GenericEvent{Object: other}))
+}
+
+func Test_hasStatusRelevantChange(t *testing.T) {
+	newConfiguration := func(mutate func(*knserving.Configuration)) *knserving.Configuration {
+		configuration := &knserving.Configuration{
+			ObjectMeta: metav1.ObjectMeta{
+				Generation:      1,
+				ResourceVersion: "1",
+				Labels:          map[string]string{"riser.dev/app": "myapp", "other": "a"},
+				Annotations:     map[string]string{"riser.dev/revision": "1", "other": "a"},
+			},
+		}
+		configuration.Status.LatestReadyRevisionName = "myapp-1"
+		configuration.Status.Conditions = duckv1.Conditions{{Type: apis.ConditionReady, Status: corea1.ConditionTrue}}
+		if mutate != nil {
+			mutate(configuration)
+		}
+		return configuration
+	}
+
+	tests := []struct {
+		name     string
+		mutate   func(*knserving.Configuration)
+		expected bool
+	}{
+		{"unchanged", nil, false},
+		{"resource version", func(c *knserving.Configuration) { c.ResourceVersion = "2" }, false},
+		{"other label", func(c *knserving.Configuration) { c.Labels["other"] = "b" }, false},
+		{"other annotation", func(c *knserving.Configuration) { c.Annotations["other"] = "b" }, false},
+		{"managed fields", func(c *knserving.Configuration) { c.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubectl"}} }, false},
+		{"generation", func(c *knserving.Configuration) { c.Generation = 2 }, true},
+		{"riser label", func(c *knserving.Configuration) { c.Labels["riser.dev/deployment"] = "myapp" }, true},
+		{"riser annotation", func(c *knserving.Configuration) { c.Annotations["riser.dev/revision"] = "2" }, true},
+		{"condition", func(c *knserving.Configuration) { c.Status.Conditions[0].Status = corea1.ConditionFalse }, true},
+		{"latest ready revision", func(c *knserving.Configuration) { c.Status.LatestReadyRevisionName = "myapp-2" }, true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, hasStatusRelevantChange(newConfiguration(nil), newConfiguration(tt.mutate)), "when %s", tt.name)
+	}
+}
+
+func Test_hasStatusRelevantChange_RouteTraffic(t *testing.T) {
+	oldRoute := &knserving.Route{}
+	oldRoute.Status.Traffic = []knserving.TrafficTarget{{RevisionName: "myapp-1", Percent: util.PtrInt64(100)}}
+	newRoute := oldRoute.DeepCopy()
+	newRoute.Status.Traffic[0].Percent = util.PtrInt64(50)
+
+	assert.False(t, hasStatusRelevantChange(oldRoute, oldRoute.DeepCopy()))
+	assert.True(t, hasStatusRelevantChange(oldRoute, newRoute))
+}
+
+func Test_hasStatusRelevantChange_SealedSecretStatus(t *testing.T) {
+	oldSecret := newSealedSecret()
+	newSecret := newSealedSecret()
+	newSecret.Object["status"] = map[string]interface{}{"conditions": []interface{}{map[string]interface{}{"type": "Synced", "status": "True"}}}
+
+	assert.False(t, hasStatusRelevantChange(oldSecret, newSealedSecret()))
+	assert.True(t, hasStatusRelevantChange(oldSecret, newSecret))
+}
+
+func Test_hasStatusRelevantChange_RevisionReadyReplicas(t *testing.T) {
+	ready, notReady := int32(2), int32(1)
+	oldRevision := &knserving.Revision{}
+	oldRevision.Status.ActualReplicas = &ready
+	newRevision := oldRevision.DeepCopy()
+	newRevision.Status.ActualReplicas = &notReady
+
+	assert.True(t, hasStatusRelevantChange(oldRevision, newRevision), "when a pod is no longer ready")
+}
+
+func Test_mapToConfiguration(t *testing.T) {
+	deployment := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: "myapp-1-deployment", Namespace: "myns", Labels: map[string]string{"serving.knative.dev/configuration": "myapp"}}}
+
+	assert.Equal(t, []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "myns", Name: "myapp"}}}, mapToConfiguration(deployment))
+	assert.Nil(t, mapToConfiguration(&metav1.PartialObjectMetadata{}))
+}
+
+func Test_isInstalled(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+
+	installed, err := isInstalled(mapper, sealedSecretGVK)
+	assert.NoError(t, err)
+	assert.False(t, installed, "when the kind is not installed")
+
+	mapper.Add(sealedSecretGVK, meta.RESTScopeNamespace)
+	installed, err = isInstalled(mapper, sealedSecretGVK)
+	assert.NoError(t, err)
+	assert.True(t, installed, "when the kind is installed")
+}
+
+func Test_Reconcile_RouteBeforeConfiguration_DoesNotReportRemoval(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Fail(t, "unexpected request", "%s %s", r.Method, r.URL.Path)
+	}))
+	defer server.Close()
+	route := &knserving.Route{ObjectMeta: metav1.ObjectMeta{Name: "myapp", Namespace: "myns", Labels: map[string]string{"riser.dev/app": "myapp"}}}
+	reconciler := newTestReconciler(t, server.URL, route)
+
+	result, err := reconciler.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "myapp", Namespace: "myns"}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+}
+
+func Test_Reconcile_ReportsRemovalOfReportedDeployment(t *testing.T) {
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+	}))
+	defer server.Close()
+	reconciler := newTestReconciler(t, server.URL)
+	name := types.NamespacedName{Name: "myapp", Namespace: "myns"}
+	reconciler.Reported.Add(name, "prod")
+
+	result, err := reconciler.Reconcile(context.Background(), ctrl.Request{NamespacedName: name})
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+	// The removal is only reported once
+	result, err = reconciler.Reconcile(context.Background(), ctrl.Request{NamespacedName: name})
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+
+	assert.Equal(t, []string{"DELETE /api/v1/deployments/prod/myns/myapp/status"}, requests)
+}
+
+func newTestReconciler(t *testing.T, serverURL string, objects ...client.Object) *KNativeReconciler {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corea1.AddToScheme(scheme))
+	require.NoError(t, knserving.AddToScheme(scheme))
+	riserClient, err := api.NewClient(serverURL, "apikey", api.ClientOptions{})
+	require.NoError(t, err)
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+	return &KNativeReconciler{
+		Client:      kubeClient,
+		APIReader:   kubeClient,
+		Log:         logr.Discard(),
+		Config:      riserruntime.Config{Environment: "dev"},
+		RiserClient: riserClient,
+		Reported:    NewReportedDeployments(),
+	}
+}
+
+func Test_Reconcile_RemovalUnsupported(t *testing.T) {
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer server.Close()
+	reconciler := newTestReconciler(t, server.URL)
+	name := types.NamespacedName{Name: "myapp", Namespace: "myns"}
+	other := types.NamespacedName{Name: "other", Namespace: "myns"}
+	reconciler.Reported.Add(name, "prod")
+	reconciler.Reported.Add(other, "prod")
+
+	result, err := reconciler.Reconcile(context.Background(), ctrl.Request{NamespacedName: name})
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+	// No other removal is reported once the server responds that it's unsupported
+	reconciler.Reported.Add(name, "prod")
+	result, err = reconciler.Reconcile(context.Background(), ctrl.Request{NamespacedName: other})
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+
+	assert.Equal(t, []string{"DELETE /api/v1/deployments/prod/myns/myapp/status"}, requests)
+	_, reported := reconciler.Reported.Remove(name)
+	assert.False(t, reported)
 }
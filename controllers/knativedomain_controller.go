@@ -3,28 +3,34 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"riser-controller/pkg/api"
+	"riser-controller/pkg/environment"
 	"riser-controller/pkg/runtime"
+	"riser-controller/pkg/util"
+	"sort"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/go-logr/logr"
 	"github.com/riser-platform/riser-server/api/v1/model"
-	"github.com/riser-platform/riser-server/pkg/sdk"
 	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	knativeroute "knative.dev/serving/pkg/reconciler/route/config"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
 const DomainConfigName = "config-domain"
-const KNativeServingNamespace = "knative-serving"
 
 type KNativeDomainReconciler struct {
 	client.Client
 	Log         logr.Logger
 	Config      runtime.Config
-	RiserClient *sdk.Client
+	RiserClient *api.Client
+	// Environments are the riser environments managed by the controller. Optional: when nil only Config.Environment is managed.
+	Environments *environment.Resolver
+	Options      ReconcileOptions
 }
 
 func (r *KNativeDomainReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -32,44 +38,146 @@ func (r *KNativeDomainReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 
 	cm := &corev1.ConfigMap{}
 
+	environmentNames := []string{r.Config.Environment}
+	if r.Environments != nil {
+		environmentNames = r.Environments.Names()
+	}
+
 	err := r.Get(ctx, req.NamespacedName, cm)
 	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return r.clearDomains(log, environmentNames)
+		}
 		log.Error(err, "Unable to get configmap")
 		return ctrl.Result{}, err
 	}
 
-	for key := range cm.Data {
-		// Select the first key that does not start with an underscore (e.g. "_example").
-		// This is an intentional Riser limitation for now (single domain per environment/cluster). In the future we should read the selector
-		// with a riser specific label
-		if key[:1] != "_" {
-			log.Info(fmt.Sprintf("Found custom domain %q. Updating environment config...", key))
-			err = r.RiserClient.Environments.SetConfig(r.Config.Environment, &model.EnvironmentConfig{
-				PublicGatewayHost: key,
-			})
-			if err != nil {
-				return ctrl.Result{Requeue: true}, err
-			}
+	domains, err := getEnvironmentDomains(cm, environmentNames)
+	if err != nil {
+		log.Error(err, "Unable to parse domain config")
+		return ctrl.Result{}, nil
+	}
+
+	for _, environmentName := range environmentNames {
+		domain, ok := domains[environmentName]
+		if !ok {
+			continue
+		}
+		log.Info(fmt.Sprintf("Found custom domain %q. Updating environment config...", domain), "environment", environmentName)
+		err = api.SetEnvironmentConfig(r.RiserClient, environmentName, &api.EnvironmentConfig{
+			EnvironmentConfig: model.EnvironmentConfig{PublicGatewayHost: domain},
+		})
+		if err != nil {
+			return ctrl.Result{Requeue: true}, err
 		}
 	}
 
 	return ctrl.Result{}, nil
 }
 
+// clearDomains clears the public gateway host of every environment after the domain config is deleted. Environments without a public gateway
+// host on the server are skipped.
+func (r *KNativeDomainReconciler) clearDomains(log logr.Logger, environmentNames []string) (ctrl.Result, error) {
+	for _, environmentName := range environmentNames {
+		config, err := api.GetEnvironmentConfig(r.RiserClient, environmentName)
+		if err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+		if config.PublicGatewayHost == "" {
+			continue
+		}
+		log.Info("Domain config deleted. Clearing public gateway host...", "environment", environmentName)
+		err = api.ClearPublicGatewayHost(r.RiserClient, environmentName)
+		if err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+/*
+getEnvironmentDomains returns the custom domain of each environment. A domain is selected the same way that knative selects the domain of a route
+labeled with the environment (see environment.LabelKey), e.g.
+
+	data:
+	  example.com: ""
+	  prod.example.com: |
+	    selector:
+	      riser.dev/environment: prod
+
+Environments without a custom domain are not included. Keys starting with an underscore (e.g. "_example") are ignored.
+
+A config without any environment selector (e.g. a single environment install that selects on other labels) is used the same way as before
+environments were supported: the first custom domain is used for an environment that no domain is selected for.
+*/
+func getEnvironmentDomains(cm *corev1.ConfigMap, environmentNames []string) (map[string]string, error) {
+	custom := &corev1.ConfigMap{Data: map[string]string{}}
+	for key, value := range cm.Data {
+		if key[:1] != "_" {
+			custom.Data[key] = value
+		}
+	}
+
+	domainConfig, err := knativeroute.NewDomainFromConfigMap(custom)
+	if err != nil {
+		return nil, err
+	}
+
+	fallbackDomain := ""
+	if !hasEnvironmentSelector(domainConfig) {
+		fallbackDomain = getFirstDomain(custom)
+	}
+
+	domains := map[string]string{}
+	for _, environmentName := range environmentNames {
+		domain := domainConfig.LookupDomainForLabels(map[string]string{environment.LabelKey: environmentName})
+		// knative falls back to a default domain when none is specified
+		if _, ok := custom.Data[domain]; ok {
+			domains[environmentName] = domain
+		} else if fallbackDomain != "" {
+			domains[environmentName] = fallbackDomain
+		}
+	}
+	return domains, nil
+}
+
+func hasEnvironmentSelector(domainConfig *knativeroute.Domain) bool {
+	for _, selector := range domainConfig.Domains {
+		if _, ok := selector.Selector[environment.LabelKey]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// getFirstDomain returns the first custom domain in sorted order so that the same domain is always used
+func getFirstDomain(custom *corev1.ConfigMap) string {
+	keys := make([]string, 0, len(custom.Data))
+	for key := range custom.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return ""
+	}
+	return keys[0]
+}
+
 func (r *KNativeDomainReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.ConfigMap{}).
-		WithEventFilter(predicate.Funcs{
-			CreateFunc: func(evt event.CreateEvent) bool {
-				return filterDomainConfigMap(evt.Object)
-			},
-			UpdateFunc: func(evt event.UpdateEvent) bool {
-				return filterDomainConfigMap(evt.ObjectNew)
-			},
-		}).
+		WithOptions(r.Options.controllerOptions()).
+		WithEventFilter(domainConfigMapFilter()).
 		Complete(r)
 }
 
+// domainConfigMapFilter only passes events for the knative domain config. Deletes are passed so that the public gateway host is cleared.
+func domainConfigMapFilter() predicate.Funcs {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return filterDomainConfigMap(obj)
+	})
+}
+
 func filterDomainConfigMap(meta metav1.Object) bool {
-	return meta.GetNamespace() == KNativeServingNamespace && meta.GetName() == DomainConfigName
+	return meta.GetNamespace() == util.KNativeServingNamespace && meta.GetName() == DomainConfigName
 }
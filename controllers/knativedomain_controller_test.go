@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"riser-controller/pkg/api"
+	"riser-controller/pkg/util"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func Test_getEnvironmentDomains(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     map[string]string
+		expected map[string]string
+	}{
+		{"no custom domain", map[string]string{"_example": "example"}, map[string]string{}},
+		{"default domain", map[string]string{"_example": "example", "example.com": ""}, map[string]string{"dev": "example.com", "prod": "example.com"}},
+		{
+			"environment domain",
+			map[string]string{
+				"example.com":      "",
+				"prod.example.com": "selector:\n  riser.dev/environment: prod\n",
+			},
+			map[string]string{"dev": "example.com", "prod": "prod.example.com"},
+		},
+		{
+			"environment domain without default",
+			map[string]string{"prod.example.com": "selector:\n  riser.dev/environment: prod\n"},
+			map[string]string{"prod": "prod.example.com"},
+		},
+		{
+			"no environment selector",
+			map[string]string{"public.example.com": "selector:\n  app: public\n", "internal.example.com": "selector:\n  app: internal\n"},
+			map[string]string{"dev": "internal.example.com", "prod": "internal.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		result, err := getEnvironmentDomains(&corev1.ConfigMap{Data: tt.data}, []string{"dev", "prod"})
+		assert.NoError(t, err, "when %s", tt.name)
+		assert.Equal(t, tt.expected, result, "when %s", tt.name)
+	}
+}
+
+func Test_getEnvironmentDomains_InvalidSelector(t *testing.T) {
+	_, err := getEnvironmentDomains(&corev1.ConfigMap{Data: map[string]string{"example.com": "selector: invalid"}}, []string{"dev"})
+
+	assert.Error(t, err)
+}
+
+func Test_domainConfigMapFilter(t *testing.T) {
+	domainConfig := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: DomainConfigName, Namespace: util.KNativeServingNamespace}}
+	other := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config-gc", Namespace: util.KNativeServingNamespace}}
+	filter := domainConfigMapFilter()
+
+	assert.True(t, filter.Create(event.CreateEvent{Object: domainConfig}))
+	assert.True(t, filter.Update(event.UpdateEvent{ObjectOld: domainConfig, ObjectNew: domainConfig}))
+	assert.True(t, filter.Delete(event.DeleteEvent{Object: domainConfig}))
+	assert.False(t, filter.Create(event.CreateEvent{Object: other}))
+	assert.False(t, filter.Delete(event.DeleteEvent{Object: other}))
+	assert.False(t, filter.Generic(event.GenericEvent{Object: other}))
+}
+
+func Test_clearDomains_SkipsEnvironmentsWithoutHost(t *testing.T) {
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodGet && r.URL.Path == "/api/v1/environments/prod/config" {
+			_, _ = w.Write([]byte(`{"publicGatewayHost":"prod.example.com"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	riserClient, err := api.NewClient(server.URL, "apikey", api.ClientOptions{})
+	require.NoError(t, err)
+	reconciler := &KNativeDomainReconciler{RiserClient: riserClient}
+
+	result, err := reconciler.clearDomains(logr.Discard(), []string{"dev", "prod"})
+
+	assert.NoError(t, err)
+	assert.False(t, result.Requeue)
+	assert.Equal(t, []string{
+		"GET /api/v1/environments/dev/config",
+		"GET /api/v1/environments/prod/config",
+		"PUT /api/v1/environments/prod/config",
+	}, requests)
+}
@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+)
+
+// ReconcileOptions configure the concurrency and retries of the reconcilers. The zero value uses the controller-runtime defaults.
+type ReconcileOptions struct {
+	MaxConcurrentReconciles int
+	RetryBaseDelay          time.Duration
+	RetryMaxDelay           time.Duration
+	// retryLimiter is shared by every controller so that retries across all controllers stay below the riser server's rate limit
+	retryLimiter *rate.Limiter
+}
+
+/*
+NewReconcileOptions creates options where a failed reconcile is retried with a per-item exponential backoff between retryBaseDelay and
+retryMaxDelay. Retries across all controllers are also limited to retryQPS with bursts of up to retryBurst, whichever delay is longest.
+*/
+func NewReconcileOptions(maxConcurrentReconciles int, retryBaseDelay, retryMaxDelay time.Duration, retryQPS float64, retryBurst int) ReconcileOptions {
+	return ReconcileOptions{
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		RetryBaseDelay:          retryBaseDelay,
+		RetryMaxDelay:           retryMaxDelay,
+		retryLimiter:            rate.NewLimiter(rate.Limit(retryQPS), retryBurst),
+	}
+}
+
+// controllerOptions returns the options for a single controller. Each controller has its own per-item backoff since the same name may be
+// reconciled by more than one controller.
+func (o ReconcileOptions) controllerOptions() controller.Options {
+	if o.retryLimiter == nil {
+		return controller.Options{MaxConcurrentReconciles: o.MaxConcurrentReconciles}
+	}
+	return controller.Options{
+		MaxConcurrentReconciles: o.MaxConcurrentReconciles,
+		RateLimiter: workqueue.NewMaxOfRateLimiter(
+			workqueue.NewItemExponentialFailureRateLimiter(o.RetryBaseDelay, o.RetryMaxDelay),
+			&workqueue.BucketRateLimiter{Limiter: o.retryLimiter},
+		),
+	}
+}
@@ -0,0 +1,25 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ReconcileOptions_controllerOptions(t *testing.T) {
+	options := NewReconcileOptions(4, 10*time.Millisecond, time.Minute, 1, 2).controllerOptions()
+
+	assert.Equal(t, 4, options.MaxConcurrentReconciles)
+	assert.Equal(t, 10*time.Millisecond, options.RateLimiter.When("a"))
+	assert.Equal(t, 20*time.Millisecond, options.RateLimiter.When("a"), "when the item is retried again")
+	// Both tokens were used by the retries of "a"
+	assert.InDelta(t, time.Second, options.RateLimiter.When("b"), float64(100*time.Millisecond), "when the bucket is empty")
+}
+
+func Test_ReconcileOptions_controllerOptions_Defaults(t *testing.T) {
+	options := ReconcileOptions{}.controllerOptions()
+
+	assert.Equal(t, 0, options.MaxConcurrentReconciles)
+	assert.Nil(t, options.RateLimiter)
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+/*
+ReportedDeployments tracks the deployments whose status was reported by the controller along with their environment, so that a removal is only
+reported for a deployment that was reported. A Configuration can be missing from the cache without having been deleted, e.g. a Route is
+reconciled before its Configuration is cached, a DomainMapping references a name that is not a riser deployment, or the Configuration is excluded
+by the cache selectors.
+
+Deployments deleted while the controller is not running are not reported. A nil ReportedDeployments is valid and never reports a removal.
+Once disabled (e.g. the riser server doesn't support reporting removals) no removal is reported.
+*/
+type ReportedDeployments struct {
+	mu       sync.Mutex
+	names    map[types.NamespacedName]string
+	disabled bool
+}
+
+func NewReportedDeployments() *ReportedDeployments {
+	return &ReportedDeployments{names: map[types.NamespacedName]string{}}
+}
+
+// Add records that a status was reported (or queued to be reported) for the deployment in the environment
+func (d *ReportedDeployments) Add(name types.NamespacedName, environmentName string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.disabled {
+		d.names[name] = environmentName
+	}
+}
+
+// Remove returns the environment that the deployment was reported to and stops tracking it. Returns false if the deployment was not reported.
+func (d *ReportedDeployments) Remove(name types.NamespacedName) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	environmentName, ok := d.names[name]
+	delete(d.names, name)
+	return environmentName, ok
+}
+
+// Disable stops tracking deployments so that no removal is reported. Returns false if already disabled.
+func (d *ReportedDeployments) Disable() bool {
+	if d == nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.disabled {
+		return false
+	}
+	d.disabled = true
+	d.names = map[types.NamespacedName]string{}
+	return true
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"riser-controller/pkg/api"
+	"sort"
+	"time"
+
+	knserving "knative.dev/serving/pkg/apis/serving/v1"
+)
+
+// markGarbageCollection sets the time that knative may garbage collect each revision
+func markGarbageCollection(riserStatus *api.DeploymentStatus, gcTimes map[string]time.Time) {
+	for idx := range riserStatus.Revisions {
+		if gcTime, ok := gcTimes[riserStatus.Revisions[idx].Name]; ok {
+			riserStatus.Revisions[idx].GarbageCollectAfter = &gcTime
+		}
+	}
+}
+
+// applyRevisionRetention orders revisions by riser revision and removes all but the "limit" most recent revisions. Revisions receiving traffic,
+// the latest created and ready revisions, and revisions pending garbage collection are always retained. A limit of zero retains all revisions.
+func applyRevisionRetention(riserStatus *api.DeploymentStatus, route *knserving.Route, limit int) {
+	sortRevisionStatuses(riserStatus.Revisions)
+	sortRevisionStatuses(riserStatus.StaleRevisions)
+	if limit <= 0 {
+		return
+	}
+
+	pinned := map[string]bool{
+		riserStatus.LatestCreatedRevisionName: true,
+		riserStatus.LatestReadyRevisionName:   true,
+	}
+	for _, traffic := range route.Status.Traffic {
+		pinned[traffic.RevisionName] = true
+	}
+
+	retained := []api.DeploymentRevisionStatus{}
+	for idx, revision := range riserStatus.Revisions {
+		isRecent := idx >= len(riserStatus.Revisions)-limit
+		if isRecent || pinned[revision.Name] || revision.GarbageCollectAfter != nil {
+			retained = append(retained, revision)
+		}
+	}
+	riserStatus.Revisions = retained
+}
+
+// sortRevisionStatuses sorts by riser revision ascending. The name is used as a tie breaker since a riser revision may have more than one
+// knative revision (e.g. when a deployment is modified outside of riser).
+func sortRevisionStatuses(revisions []api.DeploymentRevisionStatus) {
+	sort.SliceStable(revisions, func(i, j int) bool {
+		if revisions[i].RiserRevision == revisions[j].RiserRevision {
+			return revisions[i].Name < revisions[j].Name
+		}
+		return revisions[i].RiserRevision < revisions[j].RiserRevision
+	})
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"riser-controller/pkg/api"
+	"testing"
+	"time"
+
+	"github.com/riser-platform/riser-server/api/v1/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	knserving "knative.dev/serving/pkg/apis/serving/v1"
+)
+
+func Test_applyRevisionRetention(t *testing.T) {
+	riserStatus := &api.DeploymentStatus{
+		DeploymentStatusMutable: model.DeploymentStatusMutable{
+			LatestCreatedRevisionName: "rev5",
+			LatestReadyRevisionName:   "rev4",
+		},
+		Revisions: []api.DeploymentRevisionStatus{
+			newRevisionStatus("rev5", 5),
+			newRevisionStatus("rev1", 1),
+			newRevisionStatus("rev3", 3),
+			newRevisionStatus("rev2", 2),
+			newRevisionStatus("rev4", 4),
+			newRevisionStatus("rev0", 0),
+		},
+	}
+	route := &knserving.Route{
+		Status: knserving.RouteStatus{
+			RouteStatusFields: knserving.RouteStatusFields{
+				Traffic: []knserving.TrafficTarget{
+					{RevisionName: "rev1"},
+				},
+			},
+		},
+	}
+
+	applyRevisionRetention(riserStatus, route, 1)
+
+	require.Len(t, riserStatus.Revisions, 3)
+	assert.Equal(t, "rev1", riserStatus.Revisions[0].Name)
+	assert.Equal(t, "rev4", riserStatus.Revisions[1].Name)
+	assert.Equal(t, "rev5", riserStatus.Revisions[2].Name)
+}
+
+func Test_applyRevisionRetention_RetainsPendingGarbageCollection(t *testing.T) {
+	gcTime := time.Now()
+	pendingGC := newRevisionStatus("rev0", 0)
+	pendingGC.GarbageCollectAfter = &gcTime
+	riserStatus := &api.DeploymentStatus{
+		Revisions: []api.DeploymentRevisionStatus{
+			newRevisionStatus("rev2", 2),
+			newRevisionStatus("rev1", 1),
+			pendingGC,
+		},
+	}
+
+	applyRevisionRetention(riserStatus, &knserving.Route{}, 1)
+
+	require.Len(t, riserStatus.Revisions, 2)
+	assert.Equal(t, "rev0", riserStatus.Revisions[0].Name)
+	assert.Equal(t, "rev2", riserStatus.Revisions[1].Name)
+}
+
+func Test_applyRevisionRetention_NoLimit(t *testing.T) {
+	riserStatus := &api.DeploymentStatus{
+		Revisions: []api.DeploymentRevisionStatus{
+			newRevisionStatus("rev1-b", 1),
+			newRevisionStatus("rev2", 2),
+			newRevisionStatus("rev1-a", 1),
+		},
+		StaleRevisions: []api.DeploymentRevisionStatus{
+			newRevisionStatus("stale2", 2),
+			newRevisionStatus("stale1", 1),
+		},
+	}
+
+	applyRevisionRetention(riserStatus, &knserving.Route{}, 0)
+
+	require.Len(t, riserStatus.Revisions, 3)
+	assert.Equal(t, "rev1-a", riserStatus.Revisions[0].Name)
+	assert.Equal(t, "rev1-b", riserStatus.Revisions[1].Name)
+	assert.Equal(t, "rev2", riserStatus.Revisions[2].Name)
+	require.Len(t, riserStatus.StaleRevisions, 2)
+	assert.Equal(t, "stale1", riserStatus.StaleRevisions[0].Name)
+	assert.Equal(t, "stale2", riserStatus.StaleRevisions[1].Name)
+}
+
+func Test_markGarbageCollection(t *testing.T) {
+	gcTime := time.Now()
+	riserStatus := &api.DeploymentStatus{
+		Revisions: []api.DeploymentRevisionStatus{
+			newRevisionStatus("rev0", 0),
+			newRevisionStatus("rev1", 1),
+		},
+	}
+
+	markGarbageCollection(riserStatus, map[string]time.Time{"rev0": gcTime})
+
+	assert.Equal(t, &gcTime, riserStatus.Revisions[0].GarbageCollectAfter)
+	assert.Nil(t, riserStatus.Revisions[1].GarbageCollectAfter)
+}
+
+func newRevisionStatus(name string, riserRevision int64) api.DeploymentRevisionStatus {
+	return api.DeploymentRevisionStatus{
+		DeploymentRevisionStatus: model.DeploymentRevisionStatus{
+			Name:          name,
+			RiserRevision: riserRevision,
+		},
+	}
+}
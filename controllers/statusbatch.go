@@ -0,0 +1,294 @@
+package controllers
+
+import (
+	"net/http"
+	"riser-controller/pkg/api"
+	"riser-controller/pkg/heartbeat"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// statusBatchMaxSize is the maximum number of statuses sent in a single request
+	statusBatchMaxSize = 100
+	// statusBatchMaxRetryDelay is the maximum delay before saving a status again after it fails to save
+	statusBatchMaxRetryDelay = time.Minute
+)
+
+// statusConflictFunc is called when the server rejects a status because it already has a status for a newer riser revision
+type statusConflictFunc func(name types.NamespacedName, observedRiserRevision int64, err error)
+
+// saveStatusBatchFunc saves the statuses of many deployments in an environment and returns the http status code of the response
+type saveStatusBatchFunc func(environmentName string, items []api.DeploymentStatusBatchItem) (int, error)
+
+/*
+StatusBatcher collects deployment statuses for a short window and saves them in a single request per environment, so that a burst of reconciles
+(e.g. after a restart or a full resync) doesn't result in a request for every deployment. Only the latest status of each deployment is saved. A nil
+status reports the removal of the deployment. Since statuses are only saved by a single goroutine, a status or removal is never overtaken by an
+older one.
+
+When the server doesn't support batching, statuses are saved individually. When the server rejects a batch, its statuses are saved
+individually so that only the rejected statuses are isolated. Statuses that fail to save (e.g. the server is unavailable) are retried with
+an exponential backoff per deployment unless a newer status has since been added. Statuses that the server rejects (any 4xx other than a
+conflict or too many requests) are dropped since retrying won't help. Conflicts are not retried by the batcher. They are passed to the
+OnConflict func instead so that the reconciler can decide whether to reconcile the deployment again.
+*/
+type StatusBatcher struct {
+	window    time.Duration
+	heartbeat *heartbeat.Tracker
+	log       logr.Logger
+	saveBatch saveStatusBatchFunc
+	save      saveStatusFunc
+
+	mu          sync.Mutex
+	statuses    map[types.NamespacedName]*batchedStatus
+	unsupported bool
+	onConflict  statusConflictFunc
+	// onRemovalUnsupported is called when the server doesn't support reporting removals
+	onRemovalUnsupported func()
+}
+
+type batchedStatus struct {
+	*bufferedStatus
+	// failures is the number of times in a row that the status failed to save
+	failures int
+	retryAt  time.Time
+}
+
+func NewStatusBatcher(riserClient *api.Client, window time.Duration, heartbeat *heartbeat.Tracker, log logr.Logger) *StatusBatcher {
+	return &StatusBatcher{
+		window:    window,
+		heartbeat: heartbeat,
+		log:       log,
+		saveBatch: func(environmentName string, items []api.DeploymentStatusBatchItem) (int, error) {
+			return api.SaveDeploymentStatuses(riserClient, environmentName, items)
+		},
+		save: func(name types.NamespacedName, buffered *bufferedStatus) (int, error) {
+			if buffered.status == nil {
+				return api.DeleteDeploymentStatus(riserClient, name.Name, name.Namespace, buffered.environmentName)
+			}
+			return api.SaveDeploymentStatus(riserClient, name.Name, name.Namespace, buffered.environmentName, buffered.status)
+		},
+		statuses: map[types.NamespacedName]*batchedStatus{},
+	}
+}
+
+// Add adds the status to the next batch, replacing any status for the deployment that has not yet been saved. A nil status reports the removal
+// of the deployment.
+func (b *StatusBatcher) Add(name types.NamespacedName, environmentName string, status *api.DeploymentStatus) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.statuses[name] = &batchedStatus{bufferedStatus: &bufferedStatus{environmentName, status}}
+}
+
+// OnConflict sets the func that is called for each status that the server rejects with a conflict
+func (b *StatusBatcher) OnConflict(onConflict func(name types.NamespacedName, observedRiserRevision int64, err error)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onConflict = onConflict
+}
+
+// OnRemovalUnsupported sets the func that is called when the server responds that it doesn't support reporting removals
+func (b *StatusBatcher) OnRemovalUnsupported(onRemovalUnsupported func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onRemovalUnsupported = onRemovalUnsupported
+}
+
+// Len returns the number of statuses that have not yet been saved
+func (b *StatusBatcher) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.statuses)
+}
+
+// Start saves the collected statuses at the end of every window
+func (b *StatusBatcher) Start() {
+	go func() {
+		for range time.Tick(b.window) {
+			b.Flush()
+		}
+	}()
+}
+
+// Flush saves every collected status except those waiting to be retried. The lock is not held while saving so that reconciles are not blocked
+// by a slow server.
+func (b *StatusBatcher) Flush() {
+	now := time.Now()
+	b.mu.Lock()
+	statuses := make(map[types.NamespacedName]*batchedStatus, len(b.statuses))
+	for name, batched := range b.statuses {
+		if !now.Before(batched.retryAt) {
+			statuses[name] = batched
+		}
+	}
+	b.mu.Unlock()
+
+	batches := map[string][]types.NamespacedName{}
+	removals := []types.NamespacedName{}
+	for name, batched := range statuses {
+		if batched.status == nil {
+			removals = append(removals, name)
+			continue
+		}
+		batches[batched.environmentName] = append(batches[batched.environmentName], name)
+	}
+
+	for environmentName, names := range batches {
+		for start := 0; start < len(names); start += statusBatchMaxSize {
+			end := start + statusBatchMaxSize
+			if end > len(names) {
+				end = len(names)
+			}
+			b.saveBatchOf(environmentName, names[start:end], statuses)
+		}
+	}
+	b.saveEach(removals, statuses)
+}
+
+// saveBatchOf saves the statuses in a single request, or individually when the server doesn't support batching or rejects the batch
+func (b *StatusBatcher) saveBatchOf(environmentName string, names []types.NamespacedName, statuses map[types.NamespacedName]*batchedStatus) {
+	if b.isUnsupported() {
+		b.saveEach(names, statuses)
+		return
+	}
+
+	items := make([]api.DeploymentStatusBatchItem, len(names))
+	for idx, name := range names {
+		items[idx] = api.DeploymentStatusBatchItem{DeploymentName: name.Name, Namespace: name.Namespace, Status: statuses[name].status}
+	}
+
+	statusCode, err := b.saveBatch(environmentName, items)
+	if err != nil {
+		if isUnsupported(statusCode) {
+			b.log.Info("The riser server does not support saving deployment statuses in a batch. Saving individually...")
+			b.mu.Lock()
+			b.unsupported = true
+			b.mu.Unlock()
+			b.saveEach(names, statuses)
+			return
+		}
+		if statusCode == http.StatusConflict || isRejected(statusCode) {
+			// The server rejects the whole batch, so each status is saved individually to find the conflicting or rejected ones
+			b.log.Info("The riser server rejected the deployment statuses. Saving individually...", "environment", environmentName,
+				"count", len(items), "statusCode", statusCode)
+			b.saveEach(names, statuses)
+			return
+		}
+		b.log.Error(err, "Error saving deployment statuses", "environment", environmentName, "count", len(items))
+		for _, name := range names {
+			b.failed(name, statuses[name])
+		}
+		return
+	}
+
+	b.log.Info("Saved deployment statuses", "environment", environmentName, "count", len(items))
+	b.heartbeat.ReconcileSucceeded()
+	for _, name := range names {
+		b.saved(name, statuses[name])
+	}
+}
+
+// saveEach saves each status (or removal) in its own request
+func (b *StatusBatcher) saveEach(names []types.NamespacedName, statuses map[types.NamespacedName]*batchedStatus) {
+	for _, name := range names {
+		batched := statuses[name]
+		log := b.log.WithValues("deployment", name, "environment", batched.environmentName)
+		if batched.status != nil {
+			log = log.WithValues("observedRiserRevision", batched.status.ObservedRiserRevision)
+		}
+		statusCode, err := b.save(name, batched.bufferedStatus)
+		switch {
+		case err == nil && batched.status == nil:
+			log.Info("Reported deployment removal")
+		case err == nil:
+			log.Info("Saved deployment status")
+			b.heartbeat.ReconcileSucceeded()
+		case statusCode == http.StatusConflict:
+			b.conflict(name, batched.bufferedStatus, err)
+		case batched.status == nil && isUnsupported(statusCode):
+			b.removalUnsupported()
+		case isRejected(statusCode):
+			log.Error(err, "The riser server rejected the deployment status. The status will not be retried.", "statusCode", statusCode)
+		default:
+			log.Error(err, "Error saving deployment status")
+			b.failed(name, batched)
+			continue
+		}
+		b.saved(name, batched)
+	}
+}
+
+// saved discards the status unless a newer status was added while it was being saved
+func (b *StatusBatcher) saved(name types.NamespacedName, batched *batchedStatus) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.statuses[name] == batched {
+		delete(b.statuses, name)
+	}
+}
+
+// failed doubles the delay before the status is saved again (starting at the window) after every failure, up to statusBatchMaxRetryDelay.
+// A newer status added while the status was being saved is not delayed.
+func (b *StatusBatcher) failed(name types.NamespacedName, batched *batchedStatus) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.statuses[name] != batched {
+		return
+	}
+	batched.failures++
+	batched.retryAt = time.Now().Add(retryDelay(b.window, batched.failures))
+}
+
+func (b *StatusBatcher) conflict(name types.NamespacedName, buffered *bufferedStatus, err error) {
+	b.mu.Lock()
+	onConflict := b.onConflict
+	b.mu.Unlock()
+
+	if onConflict == nil || buffered.status == nil {
+		b.log.Error(err, "Error saving deployment status: conflict", "deployment", name)
+		return
+	}
+	onConflict(name, buffered.status.ObservedRiserRevision, err)
+}
+
+func (b *StatusBatcher) removalUnsupported() {
+	b.mu.Lock()
+	onRemovalUnsupported := b.onRemovalUnsupported
+	b.mu.Unlock()
+
+	if onRemovalUnsupported != nil {
+		onRemovalUnsupported()
+	}
+}
+
+func (b *StatusBatcher) isUnsupported() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.unsupported
+}
+
+func retryDelay(window time.Duration, failures int) time.Duration {
+	delay := window
+	for i := 0; i < failures && delay < statusBatchMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > statusBatchMaxRetryDelay {
+		delay = statusBatchMaxRetryDelay
+	}
+	return delay
+}
+
+// isUnsupported returns true if the server responded that it doesn't support the request. The server also responds with http.StatusNotFound
+// for an unknown environment, so it's not considered unsupported.
+func isUnsupported(statusCode int) bool {
+	return statusCode == http.StatusMethodNotAllowed || statusCode == http.StatusNotImplemented
+}
+
+// isRejected returns true if the server rejected the request such that retrying it won't help
+func isRejected(statusCode int) bool {
+	return statusCode >= 400 && statusCode < 500 && statusCode != http.StatusConflict && statusCode != http.StatusTooManyRequests
+}
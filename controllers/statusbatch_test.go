@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"riser-controller/pkg/api"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func Test_StatusBatcher_Flush(t *testing.T) {
+	batcher := newTestStatusBatcher()
+	myapp := types.NamespacedName{Name: "myapp", Namespace: "myns"}
+	other := types.NamespacedName{Name: "other", Namespace: "myns"}
+	prod := types.NamespacedName{Name: "myapp", Namespace: "prodns"}
+	batcher.Add(myapp, "dev", testStatus(1))
+	batcher.Add(myapp, "dev", testStatus(2))
+	batcher.Add(other, "dev", testStatus(1))
+	batcher.Add(prod, "prod", testStatus(1))
+	batches := map[string][]api.DeploymentStatusBatchItem{}
+	batcher.saveBatch = func(environmentName string, items []api.DeploymentStatusBatchItem) (int, error) {
+		batches[environmentName] = items
+		return http.StatusOK, nil
+	}
+
+	batcher.Flush()
+
+	assert.Equal(t, 0, batcher.Len())
+	assert.Len(t, batches, 2)
+	assert.ElementsMatch(t, []api.DeploymentStatusBatchItem{
+		{DeploymentName: "myapp", Namespace: "myns", Status: testStatus(2)},
+		{DeploymentName: "other", Namespace: "myns", Status: testStatus(1)},
+	}, batches["dev"])
+	assert.Equal(t, []api.DeploymentStatusBatchItem{{DeploymentName: "myapp", Namespace: "prodns", Status: testStatus(1)}}, batches["prod"])
+}
+
+func Test_StatusBatcher_Flush_MaxSize(t *testing.T) {
+	batcher := newTestStatusBatcher()
+	for i := 0; i < statusBatchMaxSize+1; i++ {
+		batcher.Add(types.NamespacedName{Name: fmt.Sprintf("app%d", i), Namespace: "myns"}, "dev", testStatus(1))
+	}
+	batchSizes := []int{}
+	batcher.saveBatch = func(environmentName string, items []api.DeploymentStatusBatchItem) (int, error) {
+		batchSizes = append(batchSizes, len(items))
+		return http.StatusOK, nil
+	}
+
+	batcher.Flush()
+
+	assert.ElementsMatch(t, []int{statusBatchMaxSize, 1}, batchSizes)
+}
+
+func Test_StatusBatcher_Flush_RetriesWithBackoff(t *testing.T) {
+	batcher := newTestStatusBatcher()
+	name := types.NamespacedName{Name: "myapp", Namespace: "myns"}
+	batcher.Add(name, "dev", testStatus(1))
+	batchCount := 0
+	batcher.saveBatch = func(environmentName string, items []api.DeploymentStatusBatchItem) (int, error) {
+		batchCount++
+		return http.StatusInternalServerError, errors.New("failed")
+	}
+
+	batcher.Flush()
+	batcher.Flush()
+
+	assert.Equal(t, 1, batchCount, "when the retry delay has not passed")
+	assert.Equal(t, 1, batcher.Len())
+	assert.Equal(t, 1, batcher.statuses[name].failures)
+	assert.WithinDuration(t, time.Now().Add(2*time.Second), batcher.statuses[name].retryAt, 100*time.Millisecond)
+	assert.False(t, batcher.unsupported)
+
+	batcher.statuses[name].retryAt = time.Now()
+	batcher.Flush()
+	assert.Equal(t, 2, batchCount)
+	assert.WithinDuration(t, time.Now().Add(4*time.Second), batcher.statuses[name].retryAt, 100*time.Millisecond)
+
+	batcher.statuses[name].retryAt = time.Now()
+	batcher.saveBatch = func(environmentName string, items []api.DeploymentStatusBatchItem) (int, error) {
+		return http.StatusOK, nil
+	}
+	batcher.Flush()
+	assert.Equal(t, 0, batcher.Len())
+}
+
+func Test_StatusBatcher_Flush_BackoffIsPerDeployment(t *testing.T) {
+	batcher := newTestStatusBatcher()
+	failing := types.NamespacedName{Name: "failing", Namespace: "myns"}
+	other := types.NamespacedName{Name: "other", Namespace: "myns"}
+	batcher.Add(failing, "dev", testStatus(1))
+	batcher.saveBatch = func(environmentName string, items []api.DeploymentStatusBatchItem) (int, error) {
+		return http.StatusInternalServerError, errors.New("failed")
+	}
+	batcher.Flush()
+	batchedNames := []string{}
+	batcher.saveBatch = func(environmentName string, items []api.DeploymentStatusBatchItem) (int, error) {
+		for _, item := range items {
+			batchedNames = append(batchedNames, item.DeploymentName)
+		}
+		return http.StatusOK, nil
+	}
+	batcher.Add(other, "dev", testStatus(1))
+
+	batcher.Flush()
+
+	assert.Equal(t, []string{"other"}, batchedNames)
+	assert.Equal(t, 1, batcher.Len())
+	assert.Contains(t, batcher.statuses, failing)
+}
+
+func Test_StatusBatcher_Flush_DropsRejectedStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		dropped    bool
+	}{
+		{"bad request", http.StatusBadRequest, true},
+		{"forbidden", http.StatusForbidden, true},
+		{"not found", http.StatusNotFound, true},
+		{"too many requests", http.StatusTooManyRequests, false},
+		{"internal server error", http.StatusInternalServerError, false},
+	}
+
+	for _, tt := range tests {
+		batcher := newTestStatusBatcher()
+		rejected := types.NamespacedName{Name: "rejected", Namespace: "myns"}
+		saved := types.NamespacedName{Name: "saved", Namespace: "myns"}
+		batcher.Add(rejected, "dev", testStatus(1))
+		batcher.Add(saved, "dev", testStatus(1))
+		batcher.saveBatch = func(environmentName string, items []api.DeploymentStatusBatchItem) (int, error) {
+			return tt.statusCode, errors.New("batch failed")
+		}
+		savedNames := []types.NamespacedName{}
+		batcher.save = func(name types.NamespacedName, buffered *bufferedStatus) (int, error) {
+			if name == rejected {
+				return tt.statusCode, errors.New("failed")
+			}
+			savedNames = append(savedNames, name)
+			return http.StatusOK, nil
+		}
+
+		batcher.Flush()
+
+		assert.False(t, batcher.unsupported, "when %s", tt.name)
+		if tt.dropped {
+			assert.Equal(t, []types.NamespacedName{saved}, savedNames, "when %s", tt.name)
+			assert.Equal(t, 0, batcher.Len(), "when %s", tt.name)
+		} else {
+			assert.Empty(t, savedNames, "when %s", tt.name)
+			assert.Equal(t, 2, batcher.Len(), "when %s", tt.name)
+		}
+	}
+}
+
+func Test_StatusBatcher_Flush_KeepsNewerStatus(t *testing.T) {
+	batcher := newTestStatusBatcher()
+	name := types.NamespacedName{Name: "myapp", Namespace: "myns"}
+	batcher.Add(name, "dev", testStatus(1))
+	batcher.saveBatch = func(environmentName string, items []api.DeploymentStatusBatchItem) (int, error) {
+		// The lock is not held while saving
+		batcher.Add(name, "dev", testStatus(2))
+		return http.StatusOK, nil
+	}
+
+	batcher.Flush()
+
+	assert.Equal(t, 1, batcher.Len())
+	assert.EqualValues(t, 2, batcher.statuses[name].status.ObservedRiserRevision)
+	assert.Zero(t, batcher.statuses[name].failures)
+}
+
+func Test_StatusBatcher_Flush_Removal(t *testing.T) {
+	batcher := newTestStatusBatcher()
+	name := types.NamespacedName{Name: "myapp", Namespace: "myns"}
+	batcher.Add(name, "dev", testStatus(1))
+	batcher.Add(name, "dev", nil)
+	batcher.saveBatch = func(environmentName string, items []api.DeploymentStatusBatchItem) (int, error) {
+		assert.Fail(t, "removals should not be batched")
+		return http.StatusOK, nil
+	}
+	removed := []types.NamespacedName{}
+	batcher.save = func(name types.NamespacedName, buffered *bufferedStatus) (int, error) {
+		assert.Nil(t, buffered.status)
+		removed = append(removed, name)
+		return http.StatusOK, nil
+	}
+
+	batcher.Flush()
+
+	assert.Equal(t, []types.NamespacedName{name}, removed)
+	assert.Equal(t, 0, batcher.Len())
+}
+
+func Test_StatusBatcher_Flush_RemovalUnsupported(t *testing.T) {
+	batcher := newTestStatusBatcher()
+	name := types.NamespacedName{Name: "myapp", Namespace: "myns"}
+	batcher.Add(name, "dev", nil)
+	batcher.save = func(name types.NamespacedName, buffered *bufferedStatus) (int, error) {
+		return http.StatusMethodNotAllowed, errors.New("method not allowed")
+	}
+	unsupportedCount := 0
+	batcher.OnRemovalUnsupported(func() { unsupportedCount++ })
+
+	batcher.Flush()
+
+	assert.Equal(t, 1, unsupportedCount)
+	assert.Equal(t, 0, batcher.Len())
+}
+
+func Test_StatusBatcher_Flush_FallbackWhenUnsupported(t *testing.T) {
+	batcher := newTestStatusBatcher()
+	saved := types.NamespacedName{Name: "saved", Namespace: "myns"}
+	conflict := types.NamespacedName{Name: "conflict", Namespace: "myns"}
+	failed := types.NamespacedName{Name: "failed", Namespace: "myns"}
+	batcher.Add(saved, "dev", testStatus(1))
+	batcher.Add(conflict, "dev", testStatus(1))
+	batcher.Add(failed, "dev", testStatus(1))
+	batchCount := 0
+	batcher.saveBatch = func(environmentName string, items []api.DeploymentStatusBatchItem) (int, error) {
+		batchCount++
+		return http.StatusMethodNotAllowed, errors.New("method not allowed")
+	}
+	savedNames := []types.NamespacedName{}
+	batcher.save = func(name types.NamespacedName, buffered *bufferedStatus) (int, error) {
+		savedNames = append(savedNames, name)
+		switch name {
+		case conflict:
+			return http.StatusConflict, errors.New("conflict")
+		case failed:
+			return http.StatusInternalServerError, errors.New("failed")
+		}
+		return http.StatusOK, nil
+	}
+
+	batcher.Flush()
+	batcher.statuses[failed].retryAt = time.Now()
+	batcher.Flush()
+
+	assert.Equal(t, 1, batchCount, "when batching is unsupported the batch should not be retried")
+	assert.ElementsMatch(t, []types.NamespacedName{saved, conflict, failed, failed}, savedNames)
+	assert.Equal(t, 1, batcher.Len())
+	assert.Contains(t, batcher.statuses, failed)
+}
+
+func newTestStatusBatcher() *StatusBatcher {
+	return NewStatusBatcher(nil, time.Second, nil, logr.Discard())
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"net/http"
+	"riser-controller/pkg/api"
+	"riser-controller/pkg/ping"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const statusBufferRetryDuration = 5 * time.Second
+
+// saveStatusFunc saves a deployment status and returns the http status code of the response
+type saveStatusFunc func(name types.NamespacedName, status *bufferedStatus) (int, error)
+
+type bufferedStatus struct {
+	environmentName string
+	// status is nil when the deployment was removed
+	status *api.DeploymentStatus
+}
+
+// StatusBuffer holds the latest status of each deployment until its environment is registered with the riser server. Once every environment
+// is registered and the buffer is empty the buffer is closed and buffers nothing more. A nil StatusBuffer is valid and buffers nothing.
+type StatusBuffer struct {
+	mu sync.Mutex
+	// statuses includes statuses that are being saved. A status is only discarded once it's saved and a newer status was not added meanwhile.
+	statuses map[types.NamespacedName]*bufferedStatus
+	closed   bool
+}
+
+func NewStatusBuffer() *StatusBuffer {
+	return &StatusBuffer{statuses: map[types.NamespacedName]*bufferedStatus{}}
+}
+
+// Add buffers the status, replacing any previously buffered status for the deployment. A nil status buffers the removal of the deployment.
+// Returns false if the buffer is closed, in which case the status should be saved directly.
+func (b *StatusBuffer) Add(name types.NamespacedName, environmentName string, status *api.DeploymentStatus) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return false
+	}
+	b.statuses[name] = &bufferedStatus{environmentName, status}
+	return true
+}
+
+// AddIfBuffered replaces the buffered status for the deployment, including one that is being saved, so that a newer status can't be overwritten
+// by the buffered status. Returns false if no status is buffered for the deployment, in which case the newer status should be saved directly.
+func (b *StatusBuffer) AddIfBuffered(name types.NamespacedName, environmentName string, status *api.DeploymentStatus) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.statuses[name]; !ok {
+		return false
+	}
+	b.statuses[name] = &bufferedStatus{environmentName, status}
+	return true
+}
+
+// Len returns the number of buffered statuses
+func (b *StatusBuffer) Len() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.statuses)
+}
+
+// Flush saves every buffered status whose environment is registered. Statuses that fail to save remain buffered. Conflicts are dropped since
+// the server already has a newer status. Statuses that the server rejects (e.g. a removal when the server doesn't support reporting removals) are
+// dropped since retrying won't help. Returns the number of statuses that remain buffered.
+func (b *StatusBuffer) Flush(isRegistered func(environmentName string) bool, save saveStatusFunc, log logr.Logger) int {
+	b.mu.Lock()
+	names := make([]types.NamespacedName, 0, len(b.statuses))
+	for name, buffered := range b.statuses {
+		if isRegistered(buffered.environmentName) {
+			names = append(names, name)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, name := range names {
+		b.flushOne(name, save, log)
+	}
+
+	return b.Len()
+}
+
+// flushOne saves the buffered status without holding the lock so that reconciles are not blocked by a slow server
+func (b *StatusBuffer) flushOne(name types.NamespacedName, save saveStatusFunc, log logr.Logger) {
+	b.mu.Lock()
+	buffered, ok := b.statuses[name]
+	b.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	statusCode, err := save(name, buffered)
+	if err != nil && statusCode != http.StatusConflict {
+		if buffered.status == nil {
+			log.Error(err, "Error reporting buffered deployment removal", "deployment", name, "environment", buffered.environmentName)
+		} else {
+			log.Error(err, "Error saving buffered deployment status", "deployment", name, "environment", buffered.environmentName,
+				"observedRiserRevision", buffered.status.ObservedRiserRevision)
+		}
+		if !isRejected(statusCode) {
+			return
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.statuses[name] == buffered {
+		delete(b.statuses, name)
+	}
+}
+
+// closeIfEmpty closes the buffer if every environment is registered and the buffer is empty. Both are checked under the same lock as Add so
+// that a status can't be added after the final flush.
+func (b *StatusBuffer) closeIfEmpty(allRegistered bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if allRegistered && len(b.statuses) == 0 {
+		b.closed = true
+	}
+	return b.closed
+}
+
+// StartFlush saves buffered statuses as their environments are registered until every environment is registered and the buffer is empty
+func (b *StatusBuffer) StartFlush(registration *ping.Registration, riserClient *api.Client, log logr.Logger) {
+	save := func(name types.NamespacedName, buffered *bufferedStatus) (int, error) {
+		if buffered.status == nil {
+			return api.DeleteDeploymentStatus(riserClient, name.Name, name.Namespace, buffered.environmentName)
+		}
+		return api.SaveDeploymentStatus(riserClient, name.Name, name.Namespace, buffered.environmentName, buffered.status)
+	}
+	go func() {
+		for {
+			time.Sleep(statusBufferRetryDuration)
+			allRegistered := registration.IsAllRegistered()
+			b.Flush(registration.IsRegistered, save, log)
+			if b.closeIfEmpty(allRegistered) {
+				return
+			}
+		}
+	}()
+}
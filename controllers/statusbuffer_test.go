@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"riser-controller/pkg/api"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/riser-platform/riser-server/api/v1/model"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func Test_StatusBuffer_Add_LastWriteWins(t *testing.T) {
+	buffer := NewStatusBuffer()
+	name := types.NamespacedName{Name: "myapp", Namespace: "myns"}
+
+	buffer.Add(name, "dev", testStatus(1))
+	buffer.Add(name, "dev", testStatus(2))
+
+	assert.Equal(t, 1, buffer.Len())
+	assert.EqualValues(t, 2, buffer.statuses[name].status.ObservedRiserRevision)
+}
+
+func Test_StatusBuffer_AddIfBuffered(t *testing.T) {
+	buffer := NewStatusBuffer()
+	name := types.NamespacedName{Name: "myapp", Namespace: "myns"}
+	other := types.NamespacedName{Name: "other", Namespace: "myns"}
+	buffer.Add(name, "dev", testStatus(1))
+
+	assert.True(t, buffer.AddIfBuffered(name, "dev", testStatus(2)))
+	assert.False(t, buffer.AddIfBuffered(other, "dev", testStatus(1)))
+
+	assert.Equal(t, 1, buffer.Len())
+	assert.EqualValues(t, 2, buffer.statuses[name].status.ObservedRiserRevision)
+}
+
+func Test_StatusBuffer_Nil(t *testing.T) {
+	var buffer *StatusBuffer
+	name := types.NamespacedName{Name: "myapp", Namespace: "myns"}
+
+	assert.False(t, buffer.Add(name, "dev", testStatus(1)))
+
+	assert.False(t, buffer.AddIfBuffered(name, "dev", testStatus(1)))
+	assert.Equal(t, 0, buffer.Len())
+}
+
+func Test_StatusBuffer_closeIfEmpty(t *testing.T) {
+	buffer := NewStatusBuffer()
+	name := types.NamespacedName{Name: "myapp", Namespace: "myns"}
+	assert.True(t, buffer.Add(name, "dev", testStatus(1)))
+
+	assert.False(t, buffer.closeIfEmpty(true), "when the buffer is not empty")
+	delete(buffer.statuses, name)
+	assert.False(t, buffer.closeIfEmpty(false), "when an environment is not registered")
+	assert.True(t, buffer.closeIfEmpty(true), "when every environment is registered and the buffer is empty")
+
+	assert.False(t, buffer.Add(name, "dev", testStatus(2)), "when the buffer is closed")
+	assert.Equal(t, 0, buffer.Len())
+}
+
+func Test_StatusBuffer_Flush_KeepsNewerStatus(t *testing.T) {
+	buffer := NewStatusBuffer()
+	name := types.NamespacedName{Name: "myapp", Namespace: "myns"}
+	buffer.Add(name, "dev", testStatus(1))
+
+	remaining := buffer.Flush(func(string) bool { return true }, func(_ types.NamespacedName, buffered *bufferedStatus) (int, error) {
+		// The lock is not held while saving
+		assert.True(t, buffer.AddIfBuffered(name, "dev", testStatus(2)))
+		return http.StatusOK, nil
+	}, logr.Discard())
+
+	assert.Equal(t, 1, remaining)
+	assert.EqualValues(t, 2, buffer.statuses[name].status.ObservedRiserRevision)
+}
+
+func Test_StatusBuffer_Flush_DropsRejectedStatus(t *testing.T) {
+	buffer := NewStatusBuffer()
+	name := types.NamespacedName{Name: "myapp", Namespace: "myns"}
+	buffer.Add(name, "dev", nil)
+
+	remaining := buffer.Flush(func(string) bool { return true }, func(_ types.NamespacedName, buffered *bufferedStatus) (int, error) {
+		return http.StatusMethodNotAllowed, errors.New("method not allowed")
+	}, logr.Discard())
+
+	assert.Equal(t, 0, remaining)
+}
+
+func Test_StatusBuffer_Flush(t *testing.T) {
+	buffer := NewStatusBuffer()
+	saved := types.NamespacedName{Name: "saved", Namespace: "myns"}
+	conflict := types.NamespacedName{Name: "conflict", Namespace: "myns"}
+	failed := types.NamespacedName{Name: "failed", Namespace: "myns"}
+	unregistered := types.NamespacedName{Name: "unregistered", Namespace: "myns"}
+	buffer.Add(saved, "dev", testStatus(1))
+	buffer.Add(conflict, "dev", testStatus(1))
+	buffer.Add(failed, "dev", testStatus(1))
+	buffer.Add(unregistered, "prod", testStatus(1))
+	savedNames := []types.NamespacedName{}
+	isRegistered := func(environmentName string) bool {
+		return environmentName == "dev"
+	}
+
+	remaining := buffer.Flush(isRegistered, func(name types.NamespacedName, buffered *bufferedStatus) (int, error) {
+		assert.Equal(t, "dev", buffered.environmentName)
+		savedNames = append(savedNames, name)
+		switch name {
+		case conflict:
+			return http.StatusConflict, errors.New("conflict")
+		case failed:
+			return http.StatusInternalServerError, errors.New("failed")
+		}
+		return http.StatusOK, nil
+	}, logr.Discard())
+
+	assert.Equal(t, 2, remaining)
+	assert.ElementsMatch(t, []types.NamespacedName{saved, conflict, failed}, savedNames)
+	assert.Contains(t, buffer.statuses, failed)
+	assert.Contains(t, buffer.statuses, unregistered)
+}
+
+func Test_StatusBuffer_Flush_Removal(t *testing.T) {
+	buffer := NewStatusBuffer()
+	name := types.NamespacedName{Name: "myapp", Namespace: "myns"}
+	buffer.Add(name, "dev", testStatus(1))
+	buffer.Add(name, "dev", nil)
+
+	remaining := buffer.Flush(func(string) bool { return true }, func(_ types.NamespacedName, buffered *bufferedStatus) (int, error) {
+		assert.Nil(t, buffered.status)
+		return http.StatusInternalServerError, errors.New("failed")
+	}, logr.Discard())
+
+	assert.Equal(t, 1, remaining)
+}
+
+func testStatus(observedRiserRevision int64) *api.DeploymentStatus {
+	return &api.DeploymentStatus{
+		DeploymentStatusMutable: model.DeploymentStatusMutable{ObservedRiserRevision: observedRiserRevision},
+	}
+}
@@ -6,8 +6,6 @@ import (
 
 	"github.com/pkg/errors"
 
-	"sigs.k8s.io/controller-runtime/pkg/client"
-
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -21,13 +19,6 @@ func isRiserApp(obj metav1.Object) bool {
 	return b
 }
 
-func riserAppFilter(objectMeta metav1.ObjectMeta) client.MatchingLabels {
-	labels := map[string]string{
-		riserLabel("deployment"): objectMeta.Labels[riserLabel("deployment")],
-	}
-	return labels
-}
-
 func getRiserRevision(objectMeta metav1.ObjectMeta) (int64, error) {
 	v, err := strconv.ParseInt(objectMeta.Annotations[riserLabel("revision")], 10, 64)
 	if err != nil {
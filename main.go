@@ -18,13 +18,19 @@ package main
 import (
 	"flag"
 	"os"
+	"riser-controller/pkg/api"
+	"riser-controller/pkg/credential"
+	"riser-controller/pkg/environment"
+	"riser-controller/pkg/externalsecret"
+	"riser-controller/pkg/heartbeat"
 	"riser-controller/pkg/ping"
+	"riser-controller/pkg/reload"
 	riserruntime "riser-controller/pkg/runtime"
 	"riser-controller/pkg/sealedsecret"
+	"riser-controller/pkg/secretkey"
+	"riser-controller/pkg/sops"
 	"time"
 
-	"github.com/riser-platform/riser-server/pkg/sdk"
-
 	corev1 "k8s.io/api/core/v1"
 
 	"riser-controller/controllers"
@@ -33,9 +39,16 @@ import (
 	"github.com/kelseyhightower/envconfig"
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
+	corev1Client "k8s.io/client-go/kubernetes/typed/core/v1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/rest"
 	knserving "knative.dev/serving/pkg/apis/serving/v1"
+	knservingv1beta1 "knative.dev/serving/pkg/apis/serving/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	// +kubebuilder:scaffold:imports
 )
@@ -58,14 +71,18 @@ func init() {
 	exitIfError(err, "corev1")
 	err = knserving.AddToScheme(scheme)
 	exitIfError(err, "knserving")
+	err = knservingv1beta1.AddToScheme(scheme)
+	exitIfError(err, "knservingv1beta1")
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
 	// TODO: Even those these are standard switches for a kubebuilder controller, should consider moving to env vars (RuntimeConfiguration)
 	var metricsAddr string
+	var probeAddr string
 	var enableLeaderElection bool
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&probeAddr, "health-probe-addr", ":8081", "The address the health probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	flag.Parse()
@@ -79,73 +96,267 @@ func main() {
 	err = envconfig.Process(envPrefix, &rc)
 	exitIfError(err, "Error loading environment variables")
 
+	reloadWatcher := reload.NewWatcher(rc.ReloadPaths, ctrl.Log.WithName("reload"))
+	if len(rc.ReloadPaths) > 0 {
+		settings, err := reloadWatcher.Load()
+		exitIfError(err, "Error loading settings", "paths", rc.ReloadPaths)
+		applyReloadSettings(&rc, settings)
+	}
+
+	err = rc.Validate()
+	exitIfError(err, "Invalid configuration")
+
+	ctx := ctrl.SetupSignalHandler()
+
+	setupClient, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	exitIfError(err, "Unable to create kubernetes client")
+	watchNamespaces, err := controllers.ResolveWatchNamespaces(ctx, setupClient, rc.WatchNamespaces, rc.WatchNamespaceSelector)
+	exitIfError(err, "Unable to determine namespaces to watch")
+	if len(watchNamespaces) > 0 {
+		setupLog.Info("Restricting the controller to namespaces", "namespaces", watchNamespaces)
+	}
+	cacheSelectors := cache.SelectorsByObject{}
+	if rc.CacheSelectorsEnabled {
+		cacheSelectors = controllers.CacheSelectors(rc.SealedSecretEnabled)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:             scheme,
-		MetricsBindAddress: metricsAddr,
-		LeaderElection:     enableLeaderElection,
+		Scheme:                 scheme,
+		MetricsBindAddress:     metricsAddr,
+		HealthProbeBindAddress: probeAddr,
+		LeaderElection:         enableLeaderElection,
+		NewCache:               controllers.NewCacheFunc(watchNamespaces, cacheSelectors),
+		NewClient:              newClient,
 	})
 	exitIfError(err, "unable to start manager")
 
-	riserClient, err := sdk.NewClient(rc.ServerURL, rc.ServerApikey)
+	riserClient, err := api.NewClient(rc.ServerURL, rc.ServerApikey, api.ClientOptions{
+		CAFile:        rc.ServerCaFile,
+		CertFile:      rc.ServerClientCertFile,
+		KeyFile:       rc.ServerClientKeyFile,
+		MinTLSVersion: rc.ServerTlsMinVersion,
+		ProxyURL:      rc.ServerProxyURL,
+		QPS:           rc.ServerQps,
+		Burst:         rc.ServerBurst,
+	})
 	exitIfError(err, "Unable to initialize riser client")
 
+	if rc.ServerCredentialEnabled {
+		credentialRotationDuration, err := time.ParseDuration(rc.ServerCredentialRotationDuration)
+		exitIfError(err, "Unable to parse server credential rotation duration")
+		kubeClient, err := corev1Client.NewForConfig(ctrl.GetConfigOrDie())
+		exitIfError(err, "Unable to create kubernetes client")
+		credential.NewManager(riserClient, kubeClient, rc.Environment, rc.ServerCredentialSecretName, rc.ServerCredentialSecretNamespace,
+			rc.ServerRegistrationToken, credentialRotationDuration, ctrl.Log.WithName("credential")).Start()
+	}
+
+	environments := environment.NewResolver(mgr.GetClient(), rc.Environment, rc.AdditionalEnvironments, rc.EnvironmentNamespaceLabel,
+		rc.EnvironmentNamespaceAnnotation)
+	environmentNames := environments.Names()
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(ctrl.GetConfigOrDie())
+	exitIfError(err, "Unable to create discovery client")
+
+	reconcileTracker := &heartbeat.Tracker{}
+	heartbeatCollector := heartbeat.NewCollector(discoveryClient, mgr.GetAPIReader(), watchNamespaces, mgr.Elected(), reconcileTracker,
+		environments, ctrl.Log.WithName("heartbeat"))
+
 	serverPingDuration := time.Second * time.Duration(rc.ServerPingSeconds)
-	err = ping.StartNewPinger(riserClient, ctrl.Log.WithName("pinger"), rc.Environment, serverPingDuration)
-	// TODO: We need a better solution for controller->server bootstrapping. We probably need a lease model as well as a per cluster key.
-	// We exit early to take advantage of k8s backoff retry. This mitigates race conditions during initial setup of the stack.
-	if err != nil {
-		exitIfError(err, "Unable to reach server")
+	// The server may not be reachable yet (e.g. during the initial setup of the stack). Rather than exiting, we start the controllers and report
+	// not ready until the environment is registered. Deployment statuses are buffered until then.
+	registration := ping.NewRegistration(environmentNames...)
+	pingers := []*ping.Pinger{}
+	for _, environmentName := range environmentNames {
+		pinger := ping.StartNewPinger(riserClient, ctrl.Log.WithName("pinger"), environmentName, serverPingDuration, heartbeatCollector, registration)
+		pingers = append(pingers, pinger)
 	}
+	statusBuffer := controllers.NewStatusBuffer()
+	statusBuffer.StartFlush(registration, riserClient, ctrl.Log.WithName("statusbuffer"))
+
+	statusBatchDuration, err := time.ParseDuration(rc.StatusBatchDuration)
+	exitIfError(err, "Unable to parse status batch duration")
+	var statusBatcher *controllers.StatusBatcher
+	if statusBatchDuration > 0 {
+		statusBatcher = controllers.NewStatusBatcher(riserClient, statusBatchDuration, reconcileTracker, ctrl.Log.WithName("statusbatcher"))
+		statusBatcher.Start()
+	}
+
+	err = mgr.AddHealthzCheck("ping", healthz.Ping)
+	exitIfError(err, "unable to add health check")
+	err = mgr.AddReadyzCheck("registration", registration.ReadyCheck)
+	exitIfError(err, "unable to add ready check")
 
 	sealedSecretRefreshDuration, err := time.ParseDuration(rc.SealedsecretCertRefreshDuration)
 	exitIfError(err, "Unable to parse sealed secret cert refresh duration")
 
 	if rc.SealedSecretEnabled {
-		err = sealedsecret.StartCertRefresher(
+		provider, err := sealedsecret.NewProvider(
 			ctrl.GetConfigOrDie(),
-			riserClient,
-			rc.Environment,
-			rc.SealedsecretControllerName,
-			rc.SealedsecretNamespace,
-			sealedSecretRefreshDuration,
-			ctrl.Log.WithName("sealedsecret").WithName("refresher"),
+			rc.GetSealedSecretControllers(),
+			sealedsecret.CertEndpoint{
+				Mode:   rc.SealedsecretCertFetchMode,
+				Scheme: rc.SealedsecretCertScheme,
+				Port:   rc.SealedsecretCertPort,
+				Path:   rc.SealedsecretCertPath,
+				CAFile: rc.SealedsecretCertCaFile,
+				File:   rc.SealedsecretCertFile,
+			},
+			rc.SealedsecretKeyWatchEnabled,
+			sealedsecret.CertValidation{
+				MinKeyBits: rc.SealedsecretCertMinKeyBits,
+				CommonName: rc.SealedsecretCertCommonName,
+			},
+			ctrl.Log.WithName("sealedsecret"),
 		)
+		exitIfError(err, "Unable to create sealed secret provider")
+		refresher, err := secretkey.StartRefresher(provider, riserClient, environmentNames, sealedSecretRefreshDuration, ctrl.Log.WithName("sealedsecret").WithName("refresher"))
 		exitIfError(err, "Unable to start sealed secret cert refresher")
+		reloadWatcher.OnChange(func(settings reload.Settings) {
+			if settings.SealedsecretCertRefreshDuration > 0 {
+				refresher.SetInterval(settings.SealedsecretCertRefreshDuration)
+			}
+		})
 	}
 
+	secretKeyRefreshDuration, err := time.ParseDuration(rc.SecretKeyRefreshDuration)
+	exitIfError(err, "Unable to parse secret key refresh duration")
+
+	if rc.SopsEnabled {
+		provider, err := sops.NewProvider(ctrl.GetConfigOrDie(), rc.SopsConfigmapName, rc.SopsConfigmapNamespace)
+		exitIfError(err, "Unable to create SOPS provider")
+		refresher, err := secretkey.StartRefresher(provider, riserClient, environmentNames, secretKeyRefreshDuration, ctrl.Log.WithName("sops").WithName("refresher"))
+		exitIfError(err, "Unable to start SOPS refresher")
+		reloadWatcher.OnChange(func(settings reload.Settings) {
+			if settings.SecretKeyRefreshDuration > 0 {
+				refresher.SetInterval(settings.SecretKeyRefreshDuration)
+			}
+		})
+	}
+
+	if rc.ExternalSecretsEnabled {
+		provider, err := externalsecret.NewProvider(ctrl.GetConfigOrDie(), rc.ExternalSecretsApiVersion, environments)
+		exitIfError(err, "Unable to create External Secrets provider")
+		refresher, err := secretkey.StartRefresher(provider, riserClient, environmentNames, secretKeyRefreshDuration, ctrl.Log.WithName("externalsecret").WithName("refresher"))
+		exitIfError(err, "Unable to start External Secrets refresher")
+		reloadWatcher.OnChange(func(settings reload.Settings) {
+			if settings.SecretKeyRefreshDuration > 0 {
+				refresher.SetInterval(settings.SecretKeyRefreshDuration)
+			}
+		})
+	}
+
+	if len(rc.ReloadPaths) > 0 {
+		reloadCheckDuration, err := time.ParseDuration(rc.ReloadCheckDuration)
+		exitIfError(err, "Unable to parse reload check duration")
+		reloadWatcher.OnChange(func(settings reload.Settings) {
+			// The cluster credential takes precedence over a reloaded apikey
+			if settings.ServerApikey != "" && !rc.ServerCredentialEnabled {
+				riserClient.SetApikey(settings.ServerApikey)
+			}
+			if settings.ServerPingDuration > 0 {
+				for _, pinger := range pingers {
+					pinger.SetFrequency(settings.ServerPingDuration)
+				}
+			}
+		})
+		reloadWatcher.Start(reloadCheckDuration)
+	}
+
+	err = controllers.SetupFieldIndexes(ctx, mgr)
+	exitIfError(err, "unable to setup field indexes")
+
+	reconcileRetryBaseDuration, err := time.ParseDuration(rc.ReconcileRetryBaseDuration)
+	exitIfError(err, "Unable to parse reconcile retry base duration")
+	reconcileRetryMaxDuration, err := time.ParseDuration(rc.ReconcileRetryMaxDuration)
+	exitIfError(err, "Unable to parse reconcile retry max duration")
+	reconcileOptions := controllers.NewReconcileOptions(rc.ReconcileMaxConcurrent, reconcileRetryBaseDuration, reconcileRetryMaxDuration,
+		rc.ReconcileRetryQps, rc.ReconcileRetryBurst)
+
+	reportedDeployments := controllers.NewReportedDeployments()
 	err = (&controllers.KNativeConfigurationReconciler{
 		KNativeReconciler: controllers.KNativeReconciler{
-			Client:      mgr.GetClient(),
-			Log:         ctrl.Log.WithName("controllers").WithName("KNativeConfiguration"),
-			Config:      rc,
-			RiserClient: riserClient,
+			Client:        mgr.GetClient(),
+			APIReader:     mgr.GetAPIReader(),
+			Log:           ctrl.Log.WithName("controllers").WithName("KNativeConfiguration"),
+			Recorder:      mgr.GetEventRecorderFor("riser-controller"),
+			Config:        rc,
+			RiserClient:   riserClient,
+			Heartbeat:     reconcileTracker,
+			Registration:  registration,
+			StatusBuffer:  statusBuffer,
+			StatusBatcher: statusBatcher,
+			Environments:  environments,
+			Reported:      reportedDeployments,
+			Options:       reconcileOptions,
 		},
 	}).SetupWithManager(mgr)
 	exitIfError(err, "unable to create controller", "controller", "KNativeConfiguration")
 
 	err = (&controllers.KNativeRouteReconciler{
 		KNativeReconciler: controllers.KNativeReconciler{
-			Client:      mgr.GetClient(),
-			Log:         ctrl.Log.WithName("controllers").WithName("KNativeRouteReconciler"),
-			Config:      rc,
-			RiserClient: riserClient,
+			Client:        mgr.GetClient(),
+			APIReader:     mgr.GetAPIReader(),
+			Log:           ctrl.Log.WithName("controllers").WithName("KNativeRouteReconciler"),
+			Recorder:      mgr.GetEventRecorderFor("riser-controller"),
+			Config:        rc,
+			RiserClient:   riserClient,
+			Heartbeat:     reconcileTracker,
+			Registration:  registration,
+			StatusBuffer:  statusBuffer,
+			StatusBatcher: statusBatcher,
+			Environments:  environments,
+			Reported:      reportedDeployments,
+			Options:       reconcileOptions,
 		},
 	}).SetupWithManager(mgr)
 	exitIfError(err, "unable to create controller", "controller", "KNativeRouteReconciler")
 
 	err = (&controllers.KNativeDomainReconciler{
-		Client:      mgr.GetClient(),
-		Log:         ctrl.Log.WithName("controllers").WithName("KNativeDomain"),
-		Config:      rc,
-		RiserClient: riserClient,
+		Client:       mgr.GetClient(),
+		Log:          ctrl.Log.WithName("controllers").WithName("KNativeDomain"),
+		Config:       rc,
+		RiserClient:  riserClient,
+		Environments: environments,
+		Options:      reconcileOptions,
 	}).SetupWithManager(mgr)
 	exitIfError(err, "unable to create controller", "controller", "KNativeDomain")
 
 	setupLog.Info("starting manager")
-	err = mgr.Start(ctrl.SetupSignalHandler())
+	err = mgr.Start(ctx)
 	exitIfError(err, "problem starting manager")
 }
 
+// newClient creates a client that reads unstructured objects (e.g. sealed secrets) from the cache
+func newClient(cache cache.Cache, config *rest.Config, options client.Options, uncachedObjects ...client.Object) (client.Client, error) {
+	c, err := client.New(config, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.NewDelegatingClient(client.NewDelegatingClientInput{
+		CacheReader:       cache,
+		Client:            c,
+		UncachedObjects:   uncachedObjects,
+		CacheUnstructured: true,
+	})
+}
+
+// applyReloadSettings overrides the config from environment variables with the settings from the reload paths
+func applyReloadSettings(rc *riserruntime.Config, settings reload.Settings) {
+	if settings.ServerApikey != "" {
+		rc.ServerApikey = settings.ServerApikey
+	}
+	if settings.ServerPingDuration > 0 {
+		rc.ServerPingSeconds = int(settings.ServerPingDuration / time.Second)
+	}
+	if settings.SealedsecretCertRefreshDuration > 0 {
+		rc.SealedsecretCertRefreshDuration = settings.SealedsecretCertRefreshDuration.String()
+	}
+	if settings.SecretKeyRefreshDuration > 0 {
+		rc.SecretKeyRefreshDuration = settings.SecretKeyRefreshDuration.String()
+	}
+}
+
 func loadDotEnv() error {
 	_, err := os.Stat(dotEnvFile)
 	if !os.IsNotExist(err) {
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"riser-controller/pkg/version"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/riser-platform/riser-server/pkg/sdk"
+	"golang.org/x/time/rate"
+)
+
+// ClientError extends sdk.ClientError with details that the server may include in an error response
+type ClientError struct {
+	sdk.ClientError
+	// ObservedRiserRevision is the observed riser revision of the status saved by the server. Only included in a http.StatusConflict response
+	// when saving a deployment status. Zero when not included (e.g. older servers).
+	ObservedRiserRevision int64 `json:"observedRiserRevision,omitempty"`
+}
+
+// requestTimeout bounds every request so that a slow or unresponsive server can't block the controller indefinitely
+const requestTimeout = 30 * time.Second
+
+// Client is a riser server client whose credentials can be replaced at runtime (e.g. when a cluster credential is rotated). It's equivalent
+// to sdk.Client, which fixes its apikey when created. Errors from the server are returned as *ClientError.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	apikey     atomic.Value
+	// limiter is nil when requests are not rate limited. See ClientOptions.QPS.
+	limiter *rate.Limiter
+}
+
+func NewClient(baseURL string, apikey string, options ClientOptions) (*Client, error) {
+	baseURLParsed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid server URL")
+	}
+
+	transport, err := newTransport(options)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Client{baseURL: baseURLParsed, httpClient: &http.Client{Transport: transport, Timeout: requestTimeout}}
+	if options.QPS > 0 {
+		client.limiter = rate.NewLimiter(rate.Limit(options.QPS), options.Burst)
+	}
+	client.SetApikey(apikey)
+	return client, nil
+}
+
+// SetApikey replaces the apikey used for all subsequent requests
+func (c *Client) SetApikey(apikey string) {
+	c.apikey.Store(apikey)
+}
+
+func (c *Client) Apikey() string {
+	return c.apikey.Load().(string)
+}
+
+func (c *Client) newRequest(method, relativeURL string, body interface{}) (*http.Request, error) {
+	rel, err := url.Parse(relativeURL)
+	if err != nil {
+		return nil, err
+	}
+
+	bodyBuffer := &bytes.Buffer{}
+	if body != nil {
+		err = json.NewEncoder(bodyBuffer).Encode(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error marshaling json")
+		}
+	}
+
+	request, err := http.NewRequest(method, c.baseURL.ResolveReference(rel).String(), bodyBuffer)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Add("Accept", "application/json")
+	request.Header.Add("Authorization", fmt.Sprintf("Apikey: %s", c.Apikey()))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("User-Agent", fmt.Sprintf("riser-controller/%s", version.Version))
+	return request, nil
+}
+
+// do sends the request and unmarshals the response into v (if not nil). The response is returned whenever one is received, including
+// for error status codes. When rate limited the wait is not included in the request timeout.
+func (c *Client) do(request *http.Request, v interface{}) (*http.Response, error) {
+	if c.limiter != nil {
+		err := c.limiter.Wait(request.Context())
+		if err != nil {
+			return nil, errors.Wrap(err, "Error waiting for the riser server rate limit")
+		}
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	responseBytes, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return response, errors.Wrap(err, "Unable to read response")
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		clientErr := &ClientError{ClientError: sdk.ClientError{StatusCode: response.StatusCode}}
+		err = json.Unmarshal(responseBytes, clientErr)
+		if err != nil {
+			clientErr.Message = fmt.Sprintf("Unable to parse response: %s", responseBytes)
+		}
+		return response, clientErr
+	}
+
+	if v != nil {
+		err = json.Unmarshal(responseBytes, v)
+		if err != nil {
+			return response, errors.Wrap(err, string(responseBytes))
+		}
+	}
+
+	return response, nil
+}
+
+// send creates and sends a request, returning the status code of the response (0 if no response was received)
+func (c *Client) send(method, relativeURL string, body interface{}, v interface{}) (int, error) {
+	request, err := c.newRequest(method, relativeURL, body)
+	if err != nil {
+		return 0, err
+	}
+	response, err := c.do(request, v)
+	if response == nil {
+		return 0, err
+	}
+	return response.StatusCode, err
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SaveDeploymentStatus_Conflict(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/deployments/dev/myns/myapp/status", r.URL.Path)
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"message":"A newer status exists","observedRiserRevision":2}`))
+	}))
+	defer server.Close()
+	riserClient, err := NewClient(server.URL, "key", ClientOptions{})
+	require.NoError(t, err)
+
+	statusCode, err := SaveDeploymentStatus(riserClient, "myapp", "myns", "dev", &DeploymentStatus{})
+
+	assert.Equal(t, http.StatusConflict, statusCode)
+	clientErr := &ClientError{}
+	require.True(t, errors.As(err, &clientErr))
+	assert.Equal(t, http.StatusConflict, clientErr.StatusCode)
+	assert.Equal(t, "A newer status exists", clientErr.Message)
+	assert.EqualValues(t, 2, clientErr.ObservedRiserRevision)
+}
+
+func Test_NewClient_RateLimited(t *testing.T) {
+	requestCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+	}))
+	defer server.Close()
+	riserClient, err := NewClient(server.URL, "key", ClientOptions{QPS: 20, Burst: 1})
+	require.NoError(t, err)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err = riserClient.send(http.MethodGet, "/", nil, nil)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 3, requestCount)
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond, "when the burst is exceeded")
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ClusterCredential is a cluster scoped apikey issued by the riser server
+type ClusterCredential struct {
+	Apikey    string     `json:"apikey"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type clusterRegistration struct {
+	Token string `json:"token"`
+}
+
+// RegisterCluster exchanges a one-time registration token for a cluster credential
+func RegisterCluster(riserClient *Client, envName, token string) (*ClusterCredential, error) {
+	credential := &ClusterCredential{}
+	_, err := riserClient.send(http.MethodPost, fmt.Sprintf("/api/v1/environments/%s/register", envName), &clusterRegistration{Token: token}, credential)
+	if err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// RotateClusterCredential issues a new cluster credential using the current credential
+func RotateClusterCredential(riserClient *Client, envName string) (*ClusterCredential, error) {
+	credential := &ClusterCredential{}
+	_, err := riserClient.send(http.MethodPost, fmt.Sprintf("/api/v1/environments/%s/credentials/rotate", envName), nil, credential)
+	if err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// SaveDeploymentStatus is equivalent to sdk.DeploymentsClient.SaveStatus using the extended DeploymentStatus
+func SaveDeploymentStatus(riserClient *Client, deploymentName, namespace, envName string, status *DeploymentStatus) (statusCode int, err error) {
+	return riserClient.send(http.MethodPut, fmt.Sprintf("/api/v1/deployments/%s/%s/%s/status", envName, namespace, deploymentName), status, nil)
+}
+
+// DeleteDeploymentStatus reports that the deployment was removed from the cluster. A deployment without a status (e.g. it was never reported)
+// is not an error. Servers that don't support reporting removals respond with http.StatusMethodNotAllowed or http.StatusNotImplemented.
+func DeleteDeploymentStatus(riserClient *Client, deploymentName, namespace, envName string) (statusCode int, err error) {
+	statusCode, err = riserClient.send(http.MethodDelete, fmt.Sprintf("/api/v1/deployments/%s/%s/%s/status", envName, namespace, deploymentName), nil, nil)
+	if statusCode == http.StatusNotFound {
+		return statusCode, nil
+	}
+	return statusCode, err
+}
+
+// SaveDeploymentStatuses saves the status of many deployments in the environment in a single request. Servers that don't support batching
+// respond with http.StatusMethodNotAllowed or http.StatusNotImplemented. Older servers may also respond with http.StatusNotFound, which can't be
+// told apart from an unknown environment.
+func SaveDeploymentStatuses(riserClient *Client, envName string, items []DeploymentStatusBatchItem) (statusCode int, err error) {
+	return riserClient.send(http.MethodPut, fmt.Sprintf("/api/v1/deployments/%s/status", envName), items, nil)
+}
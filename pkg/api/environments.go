@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/riser-platform/riser-server/api/v1/model"
+)
+
+// EnvironmentConfig extends model.EnvironmentConfig with the cert of every sealed secret controller in the environment
+type EnvironmentConfig struct {
+	model.EnvironmentConfig
+	SealedSecretCerts    []SealedSecretCert    `json:"sealedSecretCerts,omitempty"`
+	Sops                 *SopsConfig           `json:"sops,omitempty"`
+	ExternalSecretStores []ExternalSecretStore `json:"externalSecretStores,omitempty"`
+}
+
+// IsEmpty returns true if the config has no values. Saving an empty config has no effect since the server only merges non-empty values.
+func (c *EnvironmentConfig) IsEmpty() bool {
+	return len(c.SealedSecretCert) == 0 && c.PublicGatewayHost == "" && len(c.SealedSecretCerts) == 0 && len(c.ExternalSecretStores) == 0 &&
+		(c.Sops == nil || (len(c.Sops.AgeRecipients) == 0 && len(c.Sops.PGPFingerprints) == 0))
+}
+
+// SealedSecretCert is the cert of a sealed secret controller and the riser namespaces and apps that it seals secrets for. A cert without any
+// namespaces or apps is the default for the environment.
+type SealedSecretCert struct {
+	Controller          string   `json:"controller"`
+	ControllerNamespace string   `json:"controllerNamespace"`
+	Cert                []byte   `json:"cert"`
+	Namespaces          []string `json:"namespaces,omitempty"`
+	Apps                []string `json:"apps,omitempty"`
+}
+
+// SopsConfig are the recipients used to encrypt secrets with SOPS
+type SopsConfig struct {
+	AgeRecipients   []string `json:"ageRecipients,omitempty"`
+	PGPFingerprints []string `json:"pgpFingerprints,omitempty"`
+}
+
+// ExternalSecretStore is an External Secrets Operator SecretStore or ClusterSecretStore that secrets may be referenced from
+type ExternalSecretStore struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Kind      string `json:"kind"`
+	// Provider is the type of secret store (e.g. "vault", "aws")
+	Provider string `json:"provider,omitempty"`
+	Ready    bool   `json:"ready"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// GetEnvironmentConfig is equivalent to sdk.EnvironmentsClient.GetConfig using the extended EnvironmentConfig
+func GetEnvironmentConfig(riserClient *Client, envName string) (*EnvironmentConfig, error) {
+	config := &EnvironmentConfig{}
+	_, err := riserClient.send(http.MethodGet, fmt.Sprintf("/api/v1/environments/%s/config", envName), nil, config)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// SetEnvironmentConfig is equivalent to sdk.EnvironmentsClient.SetConfig using the extended EnvironmentConfig
+func SetEnvironmentConfig(riserClient *Client, envName string, config *EnvironmentConfig) error {
+	_, err := riserClient.send(http.MethodPut, fmt.Sprintf("/api/v1/environments/%s/config", envName), config, nil)
+	return err
+}
+
+// ClearPublicGatewayHost removes the public gateway host from the environment config. The host can't be cleared with SetEnvironmentConfig since
+// an empty model.EnvironmentConfig.PublicGatewayHost is omitted, which leaves the existing host unchanged.
+func ClearPublicGatewayHost(riserClient *Client, envName string) error {
+	_, err := riserClient.send(http.MethodPut, fmt.Sprintf("/api/v1/environments/%s/config", envName), map[string]string{"publicGatewayHost": ""}, nil)
+	return err
+}
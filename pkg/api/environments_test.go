@@ -0,0 +1,27 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/riser-platform/riser-server/api/v1/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_EnvironmentConfig_IsEmpty(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *EnvironmentConfig
+		expected bool
+	}{
+		{"no values", &EnvironmentConfig{}, true},
+		{"empty values", &EnvironmentConfig{SealedSecretCerts: []SealedSecretCert{}, Sops: &SopsConfig{}, ExternalSecretStores: []ExternalSecretStore{}}, true},
+		{"public gateway host", &EnvironmentConfig{EnvironmentConfig: model.EnvironmentConfig{PublicGatewayHost: "example.com"}}, false},
+		{"sealed secret cert", &EnvironmentConfig{EnvironmentConfig: model.EnvironmentConfig{SealedSecretCert: []byte("cert")}}, false},
+		{"sops", &EnvironmentConfig{Sops: &SopsConfig{AgeRecipients: []string{"age1"}}}, false},
+		{"external secret stores", &EnvironmentConfig{ExternalSecretStores: []ExternalSecretStore{{Name: "vault"}}}, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, tt.config.IsEmpty(), "when %s", tt.name)
+	}
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Heartbeat is sent with each ping so that the riser server can show environment health and detect version skew across clusters
+type Heartbeat struct {
+	ControllerVersion     string `json:"controllerVersion"`
+	ControllerCommit      string `json:"controllerCommit"`
+	KubernetesVersion     string `json:"kubernetesVersion,omitempty"`
+	KnativeServingVersion string `json:"knativeServingVersion,omitempty"`
+	// NodeCount is the number of nodes in the cluster, which may be shared by several environments
+	NodeCount int `json:"nodeCount"`
+	// AppCount is the number of riser apps in the environment
+	AppCount int `json:"appCount"`
+	// Identity is the identity of the controller instance sending the heartbeat (e.g. the pod name)
+	Identity string `json:"identity"`
+	// Leader is true if the controller instance is the elected leader
+	Leader            bool       `json:"leader"`
+	LastReconcileTime *time.Time `json:"lastReconcileTime,omitempty"`
+}
+
+// PingEnvironment is equivalent to sdk.EnvironmentsClient.Ping with a heartbeat
+func PingEnvironment(riserClient *Client, envName string, heartbeat *Heartbeat) error {
+	_, err := riserClient.send(http.MethodPost, fmt.Sprintf("/api/v1/environments/%s/ping", envName), heartbeat, nil)
+	return err
+}
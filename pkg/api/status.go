@@ -0,0 +1,107 @@
+/*
+Package api contains extensions to the riser server API that are not yet available in the published riser-server model and sdk packages.
+Extended payloads embed their model counterpart so that fields unknown to an older server are simply ignored.
+*/
+package api
+
+import (
+	"time"
+
+	"github.com/riser-platform/riser-server/api/v1/model"
+)
+
+// DeploymentStatus extends model.DeploymentStatusMutable with additional revision details.
+type DeploymentStatus struct {
+	model.DeploymentStatusMutable
+	// Revisions shadows model.DeploymentStatusMutable.Revisions. Being less nested, this field takes precedence when marshaling.
+	Revisions []DeploymentRevisionStatus `json:"revisions,omitempty"`
+	// Traffic shadows model.DeploymentStatusMutable.Traffic
+	Traffic []DeploymentTrafficStatus `json:"traffic,omitempty"`
+	Route   *RouteStatus              `json:"route,omitempty"`
+	// Configuration describes whether the knative Configuration is ready (e.g. not failing with RevisionFailed)
+	Configuration *ConfigurationStatus `json:"configuration,omitempty"`
+	// Secrets are the riser secrets for the deployment's app
+	Secrets []SecretStatus `json:"secrets,omitempty"`
+	// StaleRevisions are revisions from a previous Configuration with the same name that have not yet been garbage collected
+	StaleRevisions []DeploymentRevisionStatus `json:"staleRevisions,omitempty"`
+}
+
+// DeploymentStatusBatchItem is the status of a single deployment in a batch (see SaveDeploymentStatuses)
+type DeploymentStatusBatchItem struct {
+	DeploymentName string            `json:"deploymentName"`
+	Namespace      string            `json:"namespace"`
+	Status         *DeploymentStatus `json:"status"`
+}
+
+// DeploymentRevisionStatus extends model.DeploymentRevisionStatus with the status of every container in the revision.
+type DeploymentRevisionStatus struct {
+	model.DeploymentRevisionStatus
+	Containers []ContainerStatus `json:"containers,omitempty"`
+	// GarbageCollectAfter is the earliest time that knative may garbage collect the revision. Only reported when revision garbage collection
+	// reporting is enabled. Nil if the revision is not eligible for garbage collection.
+	GarbageCollectAfter *time.Time `json:"garbageCollectAfter,omitempty"`
+}
+
+// DeploymentTrafficStatus extends model.DeploymentTrafficStatus with the URL generated for a tagged revision
+type DeploymentTrafficStatus struct {
+	model.DeploymentTrafficStatus
+	URL string `json:"url,omitempty"`
+}
+
+// ConfigurationStatus describes whether the knative Configuration is ready. An ObservedGeneration less than the Generation means that knative
+// has not yet processed the latest spec.
+type ConfigurationStatus struct {
+	Ready              *Condition `json:"ready,omitempty"`
+	Generation         int64      `json:"generation,omitempty"`
+	ObservedGeneration int64      `json:"observedGeneration,omitempty"`
+}
+
+// RouteStatus describes where a deployment is reachable and whether it's ready to receive traffic
+type RouteStatus struct {
+	// Ready is not true when any route condition is not true (e.g. the route references a missing revision)
+	Ready *Condition `json:"ready,omitempty"`
+	// Generation and ObservedGeneration are the same as ConfigurationStatus
+	Generation             int64                 `json:"generation,omitempty"`
+	ObservedGeneration     int64                 `json:"observedGeneration,omitempty"`
+	URL                    string                `json:"url,omitempty"`
+	IngressReady           *Condition            `json:"ingressReady,omitempty"`
+	CertificateProvisioned *Condition            `json:"certificateProvisioned,omitempty"`
+	DomainMappings         []DomainMappingStatus `json:"domainMappings,omitempty"`
+}
+
+// DomainMappingStatus describes a custom domain mapped to a deployment
+type DomainMappingStatus struct {
+	Name                   string     `json:"name"`
+	URL                    string     `json:"url,omitempty"`
+	Ready                  *Condition `json:"ready,omitempty"`
+	CertificateProvisioned *Condition `json:"certificateProvisioned,omitempty"`
+}
+
+// SecretStatus describes whether a riser secret was successfully unsealed
+type SecretStatus struct {
+	Name string `json:"name"`
+	// Synced is nil when the secret has not yet been observed by the sealed secret controller
+	Synced  *bool  `json:"synced,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Condition is a simplified knative condition
+type Condition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// ContainerStatus describes a single container (the app or a sidecar) within a revision
+type ContainerStatus struct {
+	Name        string `json:"name"`
+	Image       string `json:"image"`
+	ImageDigest string `json:"imageDigest,omitempty"`
+	// Primary is true for the container running the riser app. All other containers are sidecars.
+	Primary bool `json:"primary"`
+	// Ready is nil when there are no pods running for the revision (e.g. scaled to zero)
+	Ready  *bool  `json:"ready,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
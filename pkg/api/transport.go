@@ -0,0 +1,138 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ClientOptions configure the connection to the riser server. All files are expected to be mounted into the controller pod.
+type ClientOptions struct {
+	// CAFile is a PEM bundle of CAs trusted in addition to the system CAs
+	CAFile string
+	// CertFile and KeyFile are a PEM client certificate and key for mutual TLS. The files are reloaded when they change so that the certificate
+	// can be rotated without a restart.
+	CertFile string
+	KeyFile  string
+	// MinTLSVersion is "1.2" or "1.3". Defaults to "1.2".
+	MinTLSVersion string
+	// ProxyURL is the HTTP proxy for all requests to the riser server. Defaults to the standard proxy environment variables (e.g. HTTPS_PROXY).
+	ProxyURL string
+	// QPS and Burst limit all requests to the riser server (e.g. the reconciles of every deployment on startup or a resync) so that the
+	// server's rate limit isn't exceeded. A request waits until it's allowed. Requests are not limited when QPS is zero.
+	QPS   float64
+	Burst int
+}
+
+func newTransport(options ClientOptions) (*http.Transport, error) {
+	minVersion, err := parseTLSVersion(options.MinTLSVersion)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{MinVersion: minVersion}
+
+	if options.CAFile != "" {
+		tlsConfig.RootCAs, err = loadCAFile(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if options.CertFile != "" || options.KeyFile != "" {
+		if options.CertFile == "" || options.KeyFile == "" {
+			return nil, errors.New("Both a client certificate and key file are required for mutual TLS")
+		}
+		loader := &clientCertLoader{certFile: options.CertFile, keyFile: options.KeyFile}
+		// Fail fast if the key pair is invalid
+		_, err = loader.load()
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return loader.load()
+		}
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if options.ProxyURL != "" {
+		proxyURL, err := url.Parse(options.ProxyURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid proxy URL")
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = proxy
+	return transport, nil
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, errors.Errorf("Unsupported minimum TLS version %q. Must be one of: 1.2, 1.3", version)
+}
+
+// loadCAFile returns the system CAs with the CAs from the file appended
+func loadCAFile(caFile string) (*x509.CertPool, error) {
+	caBytes, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read server CA file")
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(caBytes) {
+		return nil, errors.Errorf("No certificates found in server CA file %q", caFile)
+	}
+	return pool, nil
+}
+
+// clientCertLoader loads the client certificate, reloading it whenever either file is modified
+type clientCertLoader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+func (l *clientCertLoader) load() (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	modTimes := [2]time.Time{}
+	for idx, file := range []string{l.certFile, l.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to read client certificate")
+		}
+		modTimes[idx] = info.ModTime()
+	}
+	if l.cert != nil && modTimes == l.modTimes {
+		return l.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to load client certificate")
+	}
+	l.cert = &cert
+	l.modTimes = modTimes
+	return l.cert, nil
+}
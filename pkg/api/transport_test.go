@@ -0,0 +1,153 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseTLSVersion(t *testing.T) {
+	tests := []struct {
+		version     string
+		expected    uint16
+		expectedErr string
+	}{
+		{"", tls.VersionTLS12, ""},
+		{"1.2", tls.VersionTLS12, ""},
+		{"1.3", tls.VersionTLS13, ""},
+		{"1.1", 0, `Unsupported minimum TLS version "1.1". Must be one of: 1.2, 1.3`},
+	}
+
+	for _, tt := range tests {
+		result, err := parseTLSVersion(tt.version)
+		if tt.expectedErr == "" {
+			assert.NoError(t, err, "when %q", tt.version)
+		} else {
+			assert.EqualError(t, err, tt.expectedErr, "when %q", tt.version)
+		}
+		assert.Equal(t, tt.expected, result, "when %q", tt.version)
+	}
+}
+
+func Test_newTransport_MutualTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Len(t, r.TLS.PeerCertificates, 1)
+		assert.Equal(t, "riser-controller", r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+	dir := t.TempDir()
+	caFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	certFile, keyFile := writeClientCert(t, dir)
+
+	riserClient, err := NewClient(server.URL, "key", ClientOptions{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, MinTLSVersion: "1.3"})
+	require.NoError(t, err)
+
+	statusCode, err := riserClient.send(http.MethodGet, "/", nil, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, statusCode)
+}
+
+func Test_newTransport_UntrustedServer(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	riserClient, err := NewClient(server.URL, "key", ClientOptions{})
+	require.NoError(t, err)
+
+	_, err = riserClient.send(http.MethodGet, "/", nil, nil)
+
+	assert.Error(t, err)
+}
+
+func Test_newTransport_Errors(t *testing.T) {
+	dir := t.TempDir()
+	invalidCAFile := filepath.Join(dir, "invalid.pem")
+	require.NoError(t, ioutil.WriteFile(invalidCAFile, []byte("invalid"), 0600))
+
+	tests := []struct {
+		name        string
+		options     ClientOptions
+		expectedErr string
+	}{
+		{"missing key file", ClientOptions{CertFile: "cert.pem"}, "Both a client certificate and key file are required for mutual TLS"},
+		{"invalid CA file", ClientOptions{CAFile: invalidCAFile}, `No certificates found in server CA file "` + invalidCAFile + `"`},
+		{"invalid proxy URL", ClientOptions{ProxyURL: "://proxy"}, `Invalid proxy URL: parse "://proxy": missing protocol scheme`},
+	}
+
+	for _, tt := range tests {
+		_, err := newTransport(tt.options)
+		assert.EqualError(t, err, tt.expectedErr, "when %s", tt.name)
+	}
+}
+
+func Test_newTransport_ProxyURL(t *testing.T) {
+	transport, err := newTransport(ClientOptions{ProxyURL: "http://proxy:3128"})
+	require.NoError(t, err)
+	request, _ := http.NewRequest(http.MethodGet, "https://riser.example.com", nil)
+
+	proxyURL, err := transport.Proxy(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "http://proxy:3128", proxyURL.String())
+}
+
+func Test_clientCertLoader_ReloadsWhenModified(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeClientCert(t, dir)
+	loader := &clientCertLoader{certFile: certFile, keyFile: keyFile}
+
+	first, err := loader.load()
+	require.NoError(t, err)
+	cached, err := loader.load()
+	require.NoError(t, err)
+	assert.Same(t, first, cached)
+
+	writeClientCert(t, dir)
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	reloaded, err := loader.load()
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Certificate, reloaded.Certificate)
+}
+
+func writeClientCert(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "riser-controller"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return writePEM(t, dir, "client.pem", "CERTIFICATE", certBytes), writePEM(t, dir, "client-key.pem", "EC PRIVATE KEY", keyBytes)
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, bytes []byte) string {
+	file := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: bytes}), 0600))
+	return file
+}
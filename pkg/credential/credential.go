@@ -0,0 +1,199 @@
+/*
+Package credential manages the cluster scoped credential that the controller uses to authenticate with the riser server. On first startup the
+controller exchanges a one-time registration token for a cluster credential which is stored in a Secret. The credential is rotated on an interval.
+*/
+package credential
+
+import (
+	"context"
+	"riser-controller/pkg/api"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1Client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// apikeyKey is the Secret key containing the cluster credential
+	apikeyKey = "apikey"
+	// rotatedAtAnnotation is the time that the credential in the Secret was issued
+	rotatedAtAnnotation = "riser.dev/rotated-at"
+
+	checkInterval         = time.Minute
+	bootstrapRetryBackoff = 10 * time.Second
+)
+
+type Manager struct {
+	riserClient       *api.Client
+	secrets           corev1Client.SecretsGetter
+	environmentName   string
+	secretName        string
+	secretNamespace   string
+	registrationToken string
+	rotationInterval  time.Duration
+	log               logr.Logger
+
+	rotatedAt time.Time
+	// unsaved is a rotated credential that has not yet been saved to the Secret
+	unsaved *corev1.Secret
+}
+
+/*
+NewManager creates a cluster credential manager. The Secret is the source of truth for the credential so that every controller replica uses the
+same credential: replicas adopt a credential rotated by another replica, and the registration token is only needed when the Secret does not exist.
+The riser server is expected to keep the previous credential valid for a grace period after rotation.
+*/
+func NewManager(riserClient *api.Client, secrets corev1Client.SecretsGetter, environmentName, secretName, secretNamespace, registrationToken string,
+	rotationInterval time.Duration, log logr.Logger) *Manager {
+	return &Manager{
+		riserClient:       riserClient,
+		secrets:           secrets,
+		environmentName:   environmentName,
+		secretName:        secretName,
+		secretNamespace:   secretNamespace,
+		registrationToken: registrationToken,
+		rotationInterval:  rotationInterval,
+		log:               log,
+	}
+}
+
+// Start loads or registers the cluster credential in the background and then keeps it up to date. Until a credential is available requests
+// to the riser server fail as unauthorized.
+func (m *Manager) Start() {
+	go func() {
+		for {
+			err := m.bootstrap()
+			if err == nil {
+				break
+			}
+			m.log.Error(err, "Unable to get cluster credential. Retrying...", "retryAfter", bootstrapRetryBackoff.String())
+			time.Sleep(bootstrapRetryBackoff)
+		}
+
+		ticker := time.NewTicker(checkInterval)
+		for range ticker.C {
+			err := m.check(time.Now())
+			if err != nil {
+				m.log.Error(err, "Error updating cluster credential")
+			}
+		}
+	}()
+}
+
+// bootstrap uses the credential from the Secret, or registers the cluster if the Secret does not exist
+func (m *Manager) bootstrap() error {
+	secret, err := m.getSecret()
+	if err == nil {
+		m.adopt(secret)
+		return nil
+	}
+	if !kerrors.IsNotFound(err) {
+		return err
+	}
+
+	if m.registrationToken == "" {
+		return errors.Errorf("The cluster credential secret %s/%s does not exist and no registration token was provided", m.secretNamespace, m.secretName)
+	}
+
+	m.log.Info("Registering cluster")
+	credential, err := api.RegisterCluster(m.riserClient, m.environmentName, m.registrationToken)
+	if err != nil {
+		return errors.Wrap(err, "Error registering cluster")
+	}
+
+	secret = m.newSecret(credential, time.Now())
+	_, err = m.secrets.Secrets(m.secretNamespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+	if err != nil {
+		if kerrors.IsAlreadyExists(err) {
+			// Another replica registered first
+			return m.bootstrap()
+		}
+		return errors.Wrap(err, "Error saving cluster credential")
+	}
+	m.adopt(secret)
+	return nil
+}
+
+// check adopts a credential rotated by another replica and rotates the credential when it's due
+func (m *Manager) check(now time.Time) error {
+	if m.unsaved != nil {
+		return m.saveRotated()
+	}
+
+	secret, err := m.getSecret()
+	if err != nil {
+		return err
+	}
+	m.adopt(secret)
+
+	if now.Before(m.rotatedAt.Add(m.rotationInterval)) {
+		return nil
+	}
+
+	m.log.Info("Rotating cluster credential")
+	credential, err := api.RotateClusterCredential(m.riserClient, m.environmentName)
+	if err != nil {
+		return errors.Wrap(err, "Error rotating cluster credential")
+	}
+
+	rotated := m.newSecret(credential, now)
+	rotated.ResourceVersion = secret.ResourceVersion
+	m.riserClient.SetApikey(credential.Apikey)
+	m.rotatedAt = now
+	m.unsaved = rotated
+	return m.saveRotated()
+}
+
+// saveRotated saves a rotated credential. The update fails if the Secret was changed since it was read (e.g. another replica rotated the
+// credential at the same time), in which case the other replica's credential is adopted on the next check.
+func (m *Manager) saveRotated() error {
+	_, err := m.secrets.Secrets(m.secretNamespace).Update(context.TODO(), m.unsaved, metav1.UpdateOptions{})
+	if err != nil && !kerrors.IsConflict(err) {
+		return errors.Wrap(err, "Error saving rotated cluster credential")
+	}
+	m.unsaved = nil
+	return nil
+}
+
+func (m *Manager) getSecret() (*corev1.Secret, error) {
+	return m.secrets.Secrets(m.secretNamespace).Get(context.TODO(), m.secretName, metav1.GetOptions{})
+}
+
+func (m *Manager) adopt(secret *corev1.Secret) {
+	apikey := string(secret.Data[apikeyKey])
+	if apikey != m.riserClient.Apikey() {
+		m.log.Info("Using cluster credential", "secret", secret.Namespace+"/"+secret.Name)
+		m.riserClient.SetApikey(apikey)
+	}
+	m.rotatedAt = getRotatedAt(secret)
+}
+
+func (m *Manager) newSecret(credential *api.ClusterCredential, rotatedAt time.Time) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      m.secretName,
+			Namespace: m.secretNamespace,
+			Annotations: map[string]string{
+				rotatedAtAnnotation: rotatedAt.UTC().Format(time.RFC3339),
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			apikeyKey: []byte(credential.Apikey),
+		},
+	}
+}
+
+// getRotatedAt returns when the credential was issued. A missing or invalid annotation (e.g. a manually created Secret) falls back to the
+// Secret's creation time.
+func getRotatedAt(secret *corev1.Secret) time.Time {
+	rotatedAt, err := time.Parse(time.RFC3339, secret.Annotations[rotatedAtAnnotation])
+	if err != nil {
+		return secret.CreationTimestamp.Time
+	}
+	return rotatedAt
+}
@@ -0,0 +1,127 @@
+package credential
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"riser-controller/pkg/api"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_bootstrap_ExistingSecret(t *testing.T) {
+	manager, _ := newTestManager(t, nil, credentialSecret("existing", time.Now()))
+
+	err := manager.bootstrap()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "existing", manager.riserClient.Apikey())
+}
+
+func Test_bootstrap_Registers(t *testing.T) {
+	var requestPath, requestApikey string
+	manager, kubeClient := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		requestPath = r.URL.Path
+		requestApikey = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{"apikey": "registered"}`))
+	})
+	manager.registrationToken = "token"
+
+	err := manager.bootstrap()
+
+	require.NoError(t, err)
+	assert.Equal(t, "/api/v1/environments/myenv/register", requestPath)
+	assert.Equal(t, "Apikey:", requestApikey)
+	assert.Equal(t, "registered", manager.riserClient.Apikey())
+	secret, err := kubeClient.CoreV1().Secrets("riser-system").Get(context.TODO(), "creds", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "registered", string(secret.Data[apikeyKey]))
+	assert.NotEmpty(t, secret.Annotations[rotatedAtAnnotation])
+}
+
+func Test_bootstrap_NoSecretOrToken(t *testing.T) {
+	manager, _ := newTestManager(t, nil)
+
+	err := manager.bootstrap()
+
+	assert.Equal(t, "The cluster credential secret riser-system/creds does not exist and no registration token was provided", err.Error())
+}
+
+func Test_check_RotatesWhenDue(t *testing.T) {
+	var requestPath, requestApikey string
+	rotatedAt := time.Now().Add(-2 * time.Hour)
+	manager, kubeClient := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		requestPath = r.URL.Path
+		requestApikey = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{"apikey": "rotated"}`))
+	}, credentialSecret("existing", rotatedAt))
+	require.NoError(t, manager.bootstrap())
+
+	err := manager.check(time.Now())
+
+	require.NoError(t, err)
+	assert.Equal(t, "/api/v1/environments/myenv/credentials/rotate", requestPath)
+	assert.Equal(t, "Apikey: existing", requestApikey)
+	assert.Equal(t, "rotated", manager.riserClient.Apikey())
+	assert.Nil(t, manager.unsaved)
+	secret, err := kubeClient.CoreV1().Secrets("riser-system").Get(context.TODO(), "creds", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "rotated", string(secret.Data[apikeyKey]))
+}
+
+func Test_check_AdoptsRotatedSecret(t *testing.T) {
+	manager, kubeClient := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Fail(t, "unexpected request", r.URL.Path)
+	}, credentialSecret("existing", time.Now()))
+	require.NoError(t, manager.bootstrap())
+	_, err := kubeClient.CoreV1().Secrets("riser-system").Update(context.TODO(), credentialSecret("other", time.Now()), metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	err = manager.check(time.Now())
+
+	assert.NoError(t, err)
+	assert.Equal(t, "other", manager.riserClient.Apikey())
+}
+
+func Test_getRotatedAt(t *testing.T) {
+	created := metav1.NewTime(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: created}}
+
+	assert.Equal(t, created.Time, getRotatedAt(secret))
+
+	secret.Annotations = map[string]string{rotatedAtAnnotation: "2021-02-01T00:00:00Z"}
+	assert.Equal(t, time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), getRotatedAt(secret))
+}
+
+func newTestManager(t *testing.T, handler http.HandlerFunc, objects ...runtime.Object) (*Manager, *fake.Clientset) {
+	if handler == nil {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	riserClient, err := api.NewClient(server.URL, "", api.ClientOptions{})
+	require.NoError(t, err)
+	kubeClient := fake.NewSimpleClientset(objects...)
+	return NewManager(riserClient, kubeClient.CoreV1(), "myenv", "creds", "riser-system", "", time.Hour, logr.Discard()), kubeClient
+}
+
+func credentialSecret(apikey string, rotatedAt time.Time) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "creds",
+			Namespace:   "riser-system",
+			Annotations: map[string]string{rotatedAtAnnotation: rotatedAt.UTC().Format(time.RFC3339)},
+		},
+		Data: map[string][]byte{apikeyKey: []byte(apikey)},
+	}
+}
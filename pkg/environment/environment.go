@@ -0,0 +1,127 @@
+/*
+Package environment maps namespaces to riser environments. By default every namespace belongs to the controller's environment. In multi-environment
+mode several riser environments share a cluster and each namespace is mapped to an environment by a namespace label or annotation.
+*/
+package environment
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// LabelKey is the label used to select the custom domain of an environment in the knative domain config
+const LabelKey = "riser.dev/environment"
+
+type Resolver struct {
+	reader             client.Reader
+	defaultEnvironment string
+	label              string
+	annotation         string
+	environments       map[string]bool
+
+	mu sync.Mutex
+	// namespaceEnvironments are the last environment resolved for each namespace so that a deleted namespace can still be resolved
+	namespaceEnvironments map[string]string
+}
+
+/*
+NewResolver creates a resolver for the default environment and any additional environments. A namespace is mapped to the environment named by its
+label or annotation (the annotation takes precedence when both are specified). Namespaces without a mapping belong to the default environment.
+Namespaces mapped to an environment that is not managed by this controller are ignored.
+
+The reader should be cached since the namespace is read for every reconcile. Only the namespace metadata is read.
+*/
+func NewResolver(reader client.Reader, defaultEnvironment string, additionalEnvironments []string, label, annotation string) *Resolver {
+	environments := map[string]bool{defaultEnvironment: true}
+	for _, environment := range additionalEnvironments {
+		environments[environment] = true
+	}
+	return &Resolver{
+		reader:                reader,
+		defaultEnvironment:    defaultEnvironment,
+		label:                 label,
+		annotation:            annotation,
+		environments:          environments,
+		namespaceEnvironments: map[string]string{},
+	}
+}
+
+// Names returns the names of all environments managed by the controller. The default environment is always first.
+func (r *Resolver) Names() []string {
+	names := []string{r.defaultEnvironment}
+	others := []string{}
+	for environment := range r.environments {
+		if environment != r.defaultEnvironment {
+			others = append(others, environment)
+		}
+	}
+	sort.Strings(others)
+	return append(names, others...)
+}
+
+// IsManaged returns true if the environment is managed by the controller
+func (r *Resolver) IsManaged(environmentName string) bool {
+	return r.environments[environmentName]
+}
+
+/*
+ForNamespace returns the environment for the namespace or an empty string if the namespace belongs to an environment that is not managed by
+the controller.
+
+A namespace that no longer exists (e.g. its deployments are being deleted along with it) resolves to the last environment resolved for the
+namespace, or an empty string if the namespace was never resolved.
+*/
+func (r *Resolver) ForNamespace(ctx context.Context, namespace string) (string, error) {
+	if r.label == "" && r.annotation == "" {
+		return r.defaultEnvironment, nil
+	}
+
+	ns := &metav1.PartialObjectMetadata{}
+	ns.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Namespace"))
+	err := r.reader.Get(ctx, types.NamespacedName{Name: namespace}, ns)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return r.namespaceEnvironments[namespace], nil
+		}
+		return "", errors.Wrap(err, "Unable to get namespace")
+	}
+
+	environmentName := r.ForNamespaceObject(ns)
+	r.namespaceEnvironments[namespace] = environmentName
+	return environmentName, nil
+}
+
+// ForNamespaceObject returns the environment for the namespace's metadata or an empty string if the namespace belongs to an environment that
+// is not managed by the controller
+func (r *Resolver) ForNamespaceObject(ns metav1.Object) string {
+	environmentName := r.getMapping(ns)
+	if environmentName == "" {
+		return r.defaultEnvironment
+	}
+	if !r.environments[environmentName] {
+		return ""
+	}
+	return environmentName
+}
+
+func (r *Resolver) getMapping(ns metav1.Object) string {
+	if r.annotation != "" {
+		if environmentName := ns.GetAnnotations()[r.annotation]; environmentName != "" {
+			return environmentName
+		}
+	}
+	if r.label != "" {
+		return ns.GetLabels()[r.label]
+	}
+	return ""
+}
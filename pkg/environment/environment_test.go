@@ -0,0 +1,103 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_Names(t *testing.T) {
+	resolver := NewResolver(nil, "dev", []string{"staging", "prod", "dev"}, "riser.dev/environment", "")
+
+	assert.Equal(t, []string{"dev", "prod", "staging"}, resolver.Names())
+	assert.True(t, resolver.IsManaged("prod"))
+	assert.False(t, resolver.IsManaged("other"))
+}
+
+func Test_ForNamespace(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		testNamespace("unmapped", nil, nil),
+		testNamespace("labeled", map[string]string{"riser.dev/environment": "prod"}, nil),
+		testNamespace("annotated", map[string]string{"riser.dev/environment": "prod"}, map[string]string{"riser.dev/environment": "staging"}),
+		testNamespace("unmanaged", map[string]string{"riser.dev/environment": "other"}, nil),
+	).Build()
+	resolver := NewResolver(reader, "dev", []string{"staging", "prod"}, "riser.dev/environment", "riser.dev/environment")
+
+	tests := []struct {
+		namespace string
+		expected  string
+	}{
+		{"unmapped", "dev"},
+		{"labeled", "prod"},
+		{"annotated", "staging"},
+		{"unmanaged", ""},
+	}
+
+	for _, tt := range tests {
+		result, err := resolver.ForNamespace(context.Background(), tt.namespace)
+		assert.NoError(t, err, "when %s", tt.namespace)
+		assert.Equal(t, tt.expected, result, "when %s", tt.namespace)
+	}
+
+	result, err := resolver.ForNamespace(context.Background(), "missing")
+	assert.NoError(t, err, "when the namespace was never resolved")
+	assert.Empty(t, result, "when the namespace was never resolved")
+}
+
+func Test_ForNamespace_Deleted(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	namespace := testNamespace("labeled", map[string]string{"riser.dev/environment": "prod"}, nil)
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(namespace).Build()
+	resolver := NewResolver(reader, "dev", []string{"prod"}, "riser.dev/environment", "")
+	_, err := resolver.ForNamespace(context.Background(), "labeled")
+	require.NoError(t, err)
+	require.NoError(t, reader.Delete(context.Background(), namespace))
+
+	result, err := resolver.ForNamespace(context.Background(), "labeled")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", result)
+}
+
+func Test_ForNamespace_Error(t *testing.T) {
+	resolver := NewResolver(&errorReader{}, "dev", nil, "riser.dev/environment", "")
+
+	_, err := resolver.ForNamespace(context.Background(), "myns")
+
+	assert.Error(t, err)
+}
+
+func Test_ForNamespace_SingleEnvironment(t *testing.T) {
+	resolver := NewResolver(nil, "dev", nil, "", "")
+
+	result, err := resolver.ForNamespace(context.Background(), "myns")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "dev", result)
+}
+
+func testNamespace(name string, labels, annotations map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels, Annotations: annotations}}
+}
+
+// errorReader fails all reads
+type errorReader struct{}
+
+func (r *errorReader) Get(_ context.Context, _ client.ObjectKey, _ client.Object) error {
+	return errors.New("test")
+}
+
+func (r *errorReader) List(_ context.Context, _ client.ObjectList, _ ...client.ListOption) error {
+	return errors.New("test")
+}
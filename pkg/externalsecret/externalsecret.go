@@ -0,0 +1,131 @@
+package externalsecret
+
+import (
+	"context"
+	"fmt"
+	"riser-controller/pkg/api"
+	"riser-controller/pkg/environment"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// Provider is a secretkey.Provider that reports the External Secrets Operator secret stores in the cluster. Riser does not encrypt secrets
+// when using External Secrets Operator. Instead, the riser server references secrets from one of the reported stores.
+type Provider struct {
+	groupVersion  schema.GroupVersion
+	dynamicClient dynamic.Interface
+	environments  *environment.Resolver
+	// namespaceEnvironments are the environments of the namespaces with a SecretStore as of the last GetConfig. See ForEnvironment.
+	namespaceEnvironments map[string]string
+}
+
+// NewProvider creates a provider for the External Secrets Operator API version (e.g. external-secrets.io/v1beta1). The environments map the
+// namespace of each SecretStore to its environment.
+func NewProvider(kubeConfig *rest.Config, apiVersion string, environments *environment.Resolver) (*Provider, error) {
+	groupVersion, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Invalid External Secrets API version %q", apiVersion))
+	}
+	client, err := dynamic.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to create dynamic client for External Secrets provider")
+	}
+	return &Provider{
+		groupVersion:          groupVersion,
+		dynamicClient:         client,
+		environments:          environments,
+		namespaceEnvironments: map[string]string{},
+	}, nil
+}
+
+func (p *Provider) Name() string {
+	return "externalsecret"
+}
+
+func (p *Provider) GetConfig() (*api.EnvironmentConfig, error) {
+	stores := []api.ExternalSecretStore{}
+	for _, resource := range []string{"clustersecretstores", "secretstores"} {
+		list, err := p.dynamicClient.Resource(p.groupVersion.WithResource(resource)).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error listing %s. Is External Secrets Operator installed?", resource))
+		}
+		for _, item := range list.Items {
+			stores = append(stores, getSecretStore(&item))
+		}
+	}
+
+	namespaceEnvironments, err := p.getNamespaceEnvironments(stores)
+	if err != nil {
+		return nil, err
+	}
+	p.namespaceEnvironments = namespaceEnvironments
+
+	return &api.EnvironmentConfig{ExternalSecretStores: stores}, nil
+}
+
+// getNamespaceEnvironments returns the environment of each namespace with a SecretStore. The namespaces are read directly rather than from the
+// manager's cache since the config is first published before the manager is started.
+func (p *Provider) getNamespaceEnvironments(stores []api.ExternalSecretStore) (map[string]string, error) {
+	namespaceEnvironments := map[string]string{}
+	for _, store := range stores {
+		if _, ok := namespaceEnvironments[store.Namespace]; ok || store.Namespace == "" {
+			continue
+		}
+		namespace, err := p.dynamicClient.Resource(corev1.SchemeGroupVersion.WithResource("namespaces")).Get(context.TODO(), store.Namespace, metav1.GetOptions{})
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error getting namespace %q", store.Namespace))
+		}
+		namespaceEnvironments[store.Namespace] = p.environments.ForNamespaceObject(namespace)
+	}
+	return namespaceEnvironments, nil
+}
+
+// ForEnvironment returns the config with only the ClusterSecretStores and the SecretStores in the environment's namespaces
+func (p *Provider) ForEnvironment(config *api.EnvironmentConfig, environmentName string) *api.EnvironmentConfig {
+	stores := []api.ExternalSecretStore{}
+	for _, store := range config.ExternalSecretStores {
+		if store.Namespace == "" || p.namespaceEnvironments[store.Namespace] == environmentName {
+			stores = append(stores, store)
+		}
+	}
+
+	if len(stores) == 0 {
+		return nil
+	}
+
+	return &api.EnvironmentConfig{ExternalSecretStores: stores}
+}
+
+func getSecretStore(obj *unstructured.Unstructured) api.ExternalSecretStore {
+	store := api.ExternalSecretStore{
+		Name:      obj.GetName(),
+		Namespace: obj.GetNamespace(),
+		Kind:      obj.GetKind(),
+	}
+
+	// The provider has a single key for the type of store (e.g. spec.provider.vault)
+	provider, _, _ := unstructured.NestedMap(obj.Object, "spec", "provider")
+	for providerType := range provider {
+		store.Provider = providerType
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != "Ready" {
+			continue
+		}
+		store.Ready = condition["status"] == "True"
+		if reason, ok := condition["reason"].(string); ok {
+			store.Reason = reason
+		}
+	}
+
+	return store
+}
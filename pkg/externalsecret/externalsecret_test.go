@@ -0,0 +1,153 @@
+package externalsecret
+
+import (
+	"riser-controller/pkg/api"
+	"riser-controller/pkg/environment"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func Test_getSecretStore(t *testing.T) {
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "external-secrets.io/v1beta1",
+			"kind":       "SecretStore",
+			"metadata": map[string]interface{}{
+				"name":      "vault",
+				"namespace": "myns",
+			},
+			"spec": map[string]interface{}{
+				"provider": map[string]interface{}{
+					"vault": map[string]interface{}{
+						"server": "https://vault.example.com",
+					},
+				},
+			},
+			"status": map[string]interface{}{
+				"conditions": []interface{}{
+					map[string]interface{}{
+						"type":   "Ready",
+						"status": "False",
+						"reason": "InvalidProviderConfig",
+					},
+				},
+			},
+		},
+	}
+
+	result := getSecretStore(obj)
+
+	assert.Equal(t, api.ExternalSecretStore{
+		Name:      "vault",
+		Namespace: "myns",
+		Kind:      "SecretStore",
+		Provider:  "vault",
+		Ready:     false,
+		Reason:    "InvalidProviderConfig",
+	}, result)
+}
+
+func Test_getSecretStore_Ready(t *testing.T) {
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind": "ClusterSecretStore",
+			"metadata": map[string]interface{}{
+				"name": "aws",
+			},
+			"spec": map[string]interface{}{
+				"provider": map[string]interface{}{
+					"aws": map[string]interface{}{},
+				},
+			},
+			"status": map[string]interface{}{
+				"conditions": []interface{}{
+					map[string]interface{}{
+						"type":   "Ready",
+						"status": "True",
+					},
+				},
+			},
+		},
+	}
+
+	result := getSecretStore(obj)
+
+	assert.Equal(t, api.ExternalSecretStore{Name: "aws", Kind: "ClusterSecretStore", Provider: "aws", Ready: true}, result)
+}
+
+func Test_GetConfig_ForEnvironment(t *testing.T) {
+	groupVersion := schema.GroupVersion{Group: "external-secrets.io", Version: "v1beta1"}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			groupVersion.WithResource("clustersecretstores"): "ClusterSecretStoreList",
+			groupVersion.WithResource("secretstores"):        "SecretStoreList",
+		},
+		testStore("ClusterSecretStore", "", "shared"),
+		testStore("SecretStore", "devns", "dev"),
+		testStore("SecretStore", "prodns", "prod"),
+		testStore("SecretStore", "otherns", "other"),
+		testNamespace("devns", ""),
+		testNamespace("prodns", "prod"),
+		testNamespace("otherns", "other"),
+	)
+	provider := &Provider{
+		groupVersion:          groupVersion,
+		dynamicClient:         dynamicClient,
+		environments:          environment.NewResolver(nil, "dev", []string{"prod"}, "riser.dev/environment", ""),
+		namespaceEnvironments: map[string]string{},
+	}
+
+	config, err := provider.GetConfig()
+	require.NoError(t, err)
+	assert.Len(t, config.ExternalSecretStores, 4)
+
+	tests := []struct {
+		environmentName string
+		expected        []string
+	}{
+		{"dev", []string{"shared", "dev"}},
+		{"prod", []string{"shared", "prod"}},
+	}
+
+	for _, tt := range tests {
+		result := provider.ForEnvironment(config, tt.environmentName)
+		names := []string{}
+		for _, store := range result.ExternalSecretStores {
+			names = append(names, store.Name)
+		}
+		assert.ElementsMatch(t, tt.expected, names, "when %s", tt.environmentName)
+	}
+}
+
+func Test_ForEnvironment_NoStores(t *testing.T) {
+	provider := &Provider{namespaceEnvironments: map[string]string{"prodns": "prod"}}
+	config := &api.EnvironmentConfig{ExternalSecretStores: []api.ExternalSecretStore{{Name: "prod", Namespace: "prodns", Kind: "SecretStore"}}}
+
+	assert.Nil(t, provider.ForEnvironment(config, "dev"))
+}
+
+func testStore(kind, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("external-secrets.io/v1beta1")
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func testNamespace(name, environmentName string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("Namespace")
+	obj.SetName(name)
+	if environmentName != "" {
+		obj.SetLabels(map[string]string{"riser.dev/environment": environmentName})
+	}
+	return obj
+}
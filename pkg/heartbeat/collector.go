@@ -0,0 +1,201 @@
+/*
+Package heartbeat collects information about the controller and the cluster that is sent to the riser server with each ping
+*/
+package heartbeat
+
+import (
+	"context"
+	"os"
+	"riser-controller/pkg/api"
+	"riser-controller/pkg/environment"
+	"riser-controller/pkg/util"
+	"riser-controller/pkg/version"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	knserving "knative.dev/serving/pkg/apis/serving/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// clusterInfoCacheDuration limits how often cluster info is collected since it's expensive relative to the ping frequency
+const clusterInfoCacheDuration = time.Minute
+
+// knativeVersionLabels are the labels that knative serving uses for its version, in order of preference
+var knativeVersionLabels = []string{"app.kubernetes.io/version", "serving.knative.dev/release"}
+
+type Collector struct {
+	discoveryClient discovery.DiscoveryInterface
+	reader          client.Reader
+	namespaces      []string
+	elected         <-chan struct{}
+	identity        string
+	tracker         *Tracker
+	environments    *environment.Resolver
+	log             logr.Logger
+
+	mu          sync.Mutex
+	clusterInfo api.Heartbeat
+	// appCounts are the number of apps in each environment. Unlike the rest of the cluster info, apps belong to a single environment.
+	appCounts            map[string]int
+	clusterInfoCollected time.Time
+	collecting           bool
+}
+
+// NewCollector creates a heartbeat collector. The reader should not use the manager's cache since the first heartbeat is collected before the
+// manager is started. Apps are only counted in the namespaces (all namespaces when empty) for the environment of their namespace. The elected
+// channel is closed when the controller instance is elected leader (see manager.Elected).
+func NewCollector(discoveryClient discovery.DiscoveryInterface, reader client.Reader, namespaces []string, elected <-chan struct{}, tracker *Tracker,
+	environments *environment.Resolver, log logr.Logger) *Collector {
+	identity, err := os.Hostname()
+	if err != nil {
+		identity = "unknown"
+	}
+	return &Collector{
+		discoveryClient: discoveryClient,
+		reader:          reader,
+		namespaces:      namespaces,
+		elected:         elected,
+		identity:        identity,
+		tracker:         tracker,
+		environments:    environments,
+		log:             log,
+	}
+}
+
+// Collect returns the heartbeat for the environment. Errors are logged and the affected fields are left empty so that a ping is never blocked.
+// The cluster info is collected without holding the lock so that the heartbeats of other environments are not blocked meanwhile. They use the
+// previous cluster info instead.
+func (c *Collector) Collect(environmentName string) *api.Heartbeat {
+	c.mu.Lock()
+	collect := !c.collecting && time.Since(c.clusterInfoCollected) > clusterInfoCacheDuration
+	c.collecting = c.collecting || collect
+	c.mu.Unlock()
+
+	if collect {
+		clusterInfo := c.collectClusterInfo()
+		appCounts := c.collectAppCounts()
+		c.mu.Lock()
+		c.clusterInfo = clusterInfo
+		c.appCounts = appCounts
+		c.clusterInfoCollected = time.Now()
+		c.collecting = false
+		c.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	heartbeat := c.clusterInfo
+	heartbeat.AppCount = c.appCounts[environmentName]
+	c.mu.Unlock()
+	heartbeat.ControllerVersion = version.Version
+	heartbeat.ControllerCommit = version.Commit
+	heartbeat.Identity = c.identity
+	heartbeat.Leader = util.IsClosed(c.elected)
+	heartbeat.LastReconcileTime = c.tracker.LastReconcile()
+	return &heartbeat
+}
+
+func (c *Collector) collectClusterInfo() api.Heartbeat {
+	clusterInfo := api.Heartbeat{}
+	ctx := context.Background()
+
+	serverVersion, err := c.discoveryClient.ServerVersion()
+	if err != nil {
+		c.log.Error(err, "Unable to get kubernetes version")
+	} else {
+		clusterInfo.KubernetesVersion = serverVersion.GitVersion
+	}
+
+	namespace := &metav1.PartialObjectMetadata{}
+	namespace.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Namespace"))
+	err = c.reader.Get(ctx, types.NamespacedName{Name: util.KNativeServingNamespace}, namespace)
+	if err != nil {
+		c.log.Error(err, "Unable to get knative serving version")
+	} else {
+		clusterInfo.KnativeServingVersion = getKnativeServingVersion(namespace)
+	}
+
+	nodes := &metav1.PartialObjectMetadataList{}
+	nodes.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("NodeList"))
+	err = c.reader.List(ctx, nodes)
+	if err != nil {
+		c.log.Error(err, "Unable to list nodes")
+	} else {
+		clusterInfo.NodeCount = len(nodes.Items)
+	}
+
+	return clusterInfo
+}
+
+// collectAppCounts returns the number of apps in each environment
+func (c *Collector) collectAppCounts() map[string]int {
+	ctx := context.Background()
+	configurations := []metav1.PartialObjectMetadata{}
+	listNamespaces := c.namespaces
+	if len(listNamespaces) == 0 {
+		listNamespaces = []string{metav1.NamespaceAll}
+	}
+	for _, namespace := range listNamespaces {
+		configurationList := &metav1.PartialObjectMetadataList{}
+		configurationList.SetGroupVersionKind(knserving.SchemeGroupVersion.WithKind("ConfigurationList"))
+		err := c.reader.List(ctx, configurationList, client.InNamespace(namespace), client.HasLabels{"riser.dev/app"})
+		if err != nil {
+			c.log.Error(err, "Unable to list riser apps", "namespace", namespace)
+			return nil
+		}
+		configurations = append(configurations, configurationList.Items...)
+	}
+
+	return countApps(configurations, c.getNamespaceEnvironments(ctx, configurations))
+}
+
+// getNamespaceEnvironments returns the environment of each namespace with a riser app. Only those namespaces are read so that listing
+// namespaces is not required.
+func (c *Collector) getNamespaceEnvironments(ctx context.Context, configurations []metav1.PartialObjectMetadata) map[string]string {
+	namespaceEnvironments := map[string]string{}
+	for _, configuration := range configurations {
+		if _, ok := namespaceEnvironments[configuration.Namespace]; ok {
+			continue
+		}
+		namespace := &metav1.PartialObjectMetadata{}
+		namespace.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Namespace"))
+		err := c.reader.Get(ctx, types.NamespacedName{Name: configuration.Namespace}, namespace)
+		if err != nil {
+			c.log.Error(err, "Unable to get namespace", "namespace", configuration.Namespace)
+			namespaceEnvironments[configuration.Namespace] = ""
+			continue
+		}
+		namespaceEnvironments[configuration.Namespace] = c.environments.ForNamespaceObject(namespace)
+	}
+	return namespaceEnvironments
+}
+
+func getKnativeServingVersion(namespace metav1.Object) string {
+	for _, label := range knativeVersionLabels {
+		if v, ok := namespace.GetLabels()[label]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// countApps returns the number of distinct riser apps in each environment. An app may have more than one deployment. Apps in a namespace
+// without an environment (e.g. the namespace was deleted) are not counted.
+func countApps(configurations []metav1.PartialObjectMetadata, namespaceEnvironments map[string]string) map[string]int {
+	apps := map[string]bool{}
+	counts := map[string]int{}
+	for _, configuration := range configurations {
+		environmentName := namespaceEnvironments[configuration.Namespace]
+		app := configuration.Namespace + "/" + configuration.Labels["riser.dev/app"]
+		if environmentName == "" || apps[app] {
+			continue
+		}
+		apps[app] = true
+		counts[environmentName]++
+	}
+	return counts
+}
@@ -0,0 +1,123 @@
+package heartbeat
+
+import (
+	"context"
+	"errors"
+	"riser-controller/pkg/environment"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sversion "k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8stesting "k8s.io/client-go/testing"
+	knserving "knative.dev/serving/pkg/apis/serving/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_getKnativeServingVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		expected string
+	}{
+		{"no labels", nil, ""},
+		{"release label", map[string]string{"serving.knative.dev/release": "v0.27.0"}, "v0.27.0"},
+		{"version label", map[string]string{"app.kubernetes.io/version": "0.27.0"}, "0.27.0"},
+		{"both labels", map[string]string{"app.kubernetes.io/version": "0.27.0", "serving.knative.dev/release": "v0.27.0"}, "0.27.0"},
+	}
+
+	for _, tt := range tests {
+		namespace := &metav1.ObjectMeta{Labels: tt.labels}
+		assert.Equal(t, tt.expected, getKnativeServingVersion(namespace), "when %s", tt.name)
+	}
+}
+
+func Test_countApps(t *testing.T) {
+	configurations := []metav1.PartialObjectMetadata{
+		appConfiguration("myns", "myapp"),
+		appConfiguration("myns", "myapp"),
+		appConfiguration("myns", "otherapp"),
+		appConfiguration("otherns", "myapp"),
+		appConfiguration("prodns", "myapp"),
+		appConfiguration("unmanagedns", "myapp"),
+		appConfiguration("deletedns", "myapp"),
+	}
+	namespaceEnvironments := map[string]string{"myns": "dev", "otherns": "dev", "prodns": "prod", "unmanagedns": ""}
+
+	assert.Equal(t, map[string]int{"dev": 3, "prod": 1}, countApps(configurations, namespaceEnvironments))
+}
+
+func Test_Collect(t *testing.T) {
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{}, FakedServerVersion: &k8sversion.Info{GitVersion: "v1.22.2"}}
+	elected := make(chan struct{})
+	close(elected)
+	tracker := &Tracker{}
+	tracker.ReconcileSucceeded()
+	collector := NewCollector(discoveryClient, &errorReader{}, nil, elected, tracker, environment.NewResolver(nil, "dev", nil, "", ""), logr.Discard())
+
+	result := collector.Collect("dev")
+
+	assert.Equal(t, "v1.22.2", result.KubernetesVersion)
+	assert.Empty(t, result.KnativeServingVersion)
+	assert.Zero(t, result.NodeCount)
+	assert.Zero(t, result.AppCount)
+	assert.True(t, result.Leader)
+	assert.NotEmpty(t, result.Identity)
+	assert.NotEmpty(t, result.ControllerVersion)
+	assert.Equal(t, tracker.LastReconcile(), result.LastReconcileTime)
+	assert.WithinDuration(t, time.Now(), collector.clusterInfoCollected, time.Second)
+}
+
+func Test_collectAppCounts_WatchNamespaces(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, knserving.AddToScheme(scheme))
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "myns", Labels: map[string]string{"riser.dev/environment": "prod"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "otherns", Labels: map[string]string{"riser.dev/environment": "prod"}}},
+		&knserving.Configuration{ObjectMeta: metav1.ObjectMeta{Name: "myapp", Namespace: "myns", Labels: map[string]string{"riser.dev/app": "myapp"}}},
+		&knserving.Configuration{ObjectMeta: metav1.ObjectMeta{Name: "otherapp", Namespace: "otherns", Labels: map[string]string{"riser.dev/app": "otherapp"}}},
+	).Build()
+	environments := environment.NewResolver(nil, "dev", []string{"prod"}, "riser.dev/environment", "")
+	collector := NewCollector(nil, &noNamespaceListReader{reader}, []string{"myns"}, nil, nil, environments, logr.Discard())
+
+	result := collector.collectAppCounts()
+
+	assert.Equal(t, map[string]int{"prod": 1}, result)
+}
+
+func appConfiguration(namespace, app string) metav1.PartialObjectMetadata {
+	return metav1.PartialObjectMetadata{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Labels: map[string]string{"riser.dev/app": app}},
+	}
+}
+
+// errorReader fails all reads so that the collector's partial heartbeat behavior can be tested
+type errorReader struct{}
+
+func (r *errorReader) Get(_ context.Context, _ client.ObjectKey, _ client.Object) error {
+	return errors.New("test")
+}
+
+func (r *errorReader) List(_ context.Context, _ client.ObjectList, _ ...client.ListOption) error {
+	return errors.New("test")
+}
+
+// noNamespaceListReader fails to list namespaces as in a namespace scoped install
+type noNamespaceListReader struct {
+	client.Reader
+}
+
+func (r *noNamespaceListReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if list.GetObjectKind().GroupVersionKind().Kind == "NamespaceList" {
+		return errors.New("forbidden")
+	}
+	return r.Reader.List(ctx, list, opts...)
+}
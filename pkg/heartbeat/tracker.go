@@ -0,0 +1,35 @@
+package heartbeat
+
+import (
+	"sync"
+	"time"
+)
+
+// Tracker tracks the last successful reconcile. A nil Tracker is valid and does nothing.
+type Tracker struct {
+	mu            sync.RWMutex
+	lastReconcile time.Time
+}
+
+func (t *Tracker) ReconcileSucceeded() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastReconcile = time.Now()
+}
+
+// LastReconcile returns the time of the last successful reconcile or nil if there has not been one
+func (t *Tracker) LastReconcile() *time.Time {
+	if t == nil {
+		return nil
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.lastReconcile.IsZero() {
+		return nil
+	}
+	lastReconcile := t.lastReconcile
+	return &lastReconcile
+}
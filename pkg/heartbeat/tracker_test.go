@@ -0,0 +1,27 @@
+package heartbeat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Tracker_LastReconcile(t *testing.T) {
+	tracker := &Tracker{}
+	assert.Nil(t, tracker.LastReconcile())
+
+	tracker.ReconcileSucceeded()
+
+	lastReconcile := tracker.LastReconcile()
+	assert.NotNil(t, lastReconcile)
+	assert.WithinDuration(t, time.Now(), *lastReconcile, time.Second)
+}
+
+func Test_Tracker_Nil(t *testing.T) {
+	var tracker *Tracker
+
+	tracker.ReconcileSucceeded()
+
+	assert.Nil(t, tracker.LastReconcile())
+}
@@ -2,39 +2,55 @@ package ping
 
 import (
 	"fmt"
+	"riser-controller/pkg/api"
 	"time"
 
-	"github.com/riser-platform/riser-server/pkg/sdk"
-
 	"github.com/go-logr/logr"
 )
 
-type pinger struct {
-	riserClient     *sdk.Client
+const (
+	bootstrapInitialBackoff = time.Second
+	bootstrapMaxBackoff     = time.Minute
+)
+
+// Pinger pings the riser server on an interval
+type Pinger struct {
+	riserClient     *api.Client
 	log             logr.Logger
 	environmentName string
 	ticker          *time.Ticker
+	heartbeat       HeartbeatCollector
+	registration    *Registration
+}
+
+// HeartbeatCollector collects the heartbeat that is sent with each ping
+type HeartbeatCollector interface {
+	Collect(environmentName string) *api.Heartbeat
 }
 
 /*
 StartNewPinger creates and starts a new pinger. The server maintains the "last ping" from a controller to track when the last communication was received
 from the controller. A ping happens automatically when a status update is received, however, since there can be periods with few status updates to
 the server, a "pinger" is needed to inform the server of connectivity.
+
+The first ping bootstraps (registers) a new environment. Since the server may not be reachable yet (e.g. during the initial install of the stack),
+the first ping is retried in the background with an exponential backoff. The registration reports when the environment is registered.
 */
-func StartNewPinger(riserClient *sdk.Client, log logr.Logger, environmentName string, pingFrequency time.Duration) error {
-	ping := &pinger{riserClient, log, environmentName, time.NewTicker(pingFrequency)}
-	// We block on the first ping since this bootstraps a new environment. We probably want to remove this in favor of environment config endpoints
-	// on the server creating the environment if it doesn't exist.
-	err := ping.ping()
-	if err != nil {
-		return err
-	}
+func StartNewPinger(riserClient *api.Client, log logr.Logger, environmentName string, pingFrequency time.Duration, heartbeat HeartbeatCollector,
+	registration *Registration) *Pinger {
+	ping := &Pinger{riserClient, log, environmentName, time.NewTicker(pingFrequency), heartbeat, registration}
 	ping.start()
-	return nil
+	return ping
+}
+
+// SetFrequency changes the ping frequency. The next ping happens after the new frequency has elapsed.
+func (ping *Pinger) SetFrequency(pingFrequency time.Duration) {
+	ping.ticker.Reset(pingFrequency)
 }
 
-func (ping *pinger) start() {
+func (ping *Pinger) start() {
 	go func() {
+		ping.bootstrap()
 		for {
 			<-ping.ticker.C
 			err := ping.ping()
@@ -45,6 +61,29 @@ func (ping *pinger) start() {
 	}()
 }
 
-func (ping *pinger) ping() error {
-	return ping.riserClient.Environments.Ping(ping.environmentName)
+func (ping *Pinger) bootstrap() {
+	backoff := bootstrapInitialBackoff
+	for {
+		err := ping.ping()
+		if err == nil {
+			ping.log.Info(fmt.Sprintf("Registered environment %q", ping.environmentName))
+			ping.registration.markRegistered(ping.environmentName)
+			return
+		}
+		ping.log.Error(err, "Unable to reach server. Retrying...", "retryAfter", backoff.String())
+		time.Sleep(backoff)
+		backoff = nextBackoff(backoff)
+	}
+}
+
+func nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > bootstrapMaxBackoff {
+		return bootstrapMaxBackoff
+	}
+	return backoff
+}
+
+func (ping *Pinger) ping() error {
+	return api.PingEnvironment(ping.riserClient, ping.environmentName, ping.heartbeat.Collect(ping.environmentName))
 }
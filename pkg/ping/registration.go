@@ -0,0 +1,87 @@
+package ping
+
+import (
+	"fmt"
+	"net/http"
+	"riser-controller/pkg/util"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registration tracks which environments have been registered with the riser server. The first successful ping registers an environment.
+type Registration struct {
+	mu         sync.Mutex
+	registered map[string]chan struct{}
+}
+
+func NewRegistration(environmentNames ...string) *Registration {
+	registration := &Registration{registered: map[string]chan struct{}{}}
+	for _, environmentName := range environmentNames {
+		registration.registered[environmentName] = make(chan struct{})
+	}
+	return registration
+}
+
+// Registered returns a channel that is closed once the environment is registered
+func (r *Registration) Registered(environmentName string) <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.get(environmentName)
+}
+
+func (r *Registration) get(environmentName string) chan struct{} {
+	registered, ok := r.registered[environmentName]
+	if !ok {
+		registered = make(chan struct{})
+		r.registered[environmentName] = registered
+	}
+	return registered
+}
+
+// IsRegistered returns true if the environment is registered. A nil Registration always considers an environment registered.
+func (r *Registration) IsRegistered(environmentName string) bool {
+	if r == nil {
+		return true
+	}
+	return util.IsClosed(r.Registered(environmentName))
+}
+
+// IsAllRegistered returns true if every environment is registered
+func (r *Registration) IsAllRegistered() bool {
+	return len(r.pending()) == 0
+}
+
+// ReadyCheck is a healthz.Checker that reports the controller as not ready until every environment is registered
+func (r *Registration) ReadyCheck(_ *http.Request) error {
+	pending := r.pending()
+	if len(pending) > 0 {
+		return fmt.Errorf("environments not yet registered with the riser server: %s", strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+func (r *Registration) pending() []string {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pending := []string{}
+	for environmentName, registered := range r.registered {
+		if !util.IsClosed(registered) {
+			pending = append(pending, environmentName)
+		}
+	}
+	sort.Strings(pending)
+	return pending
+}
+
+func (r *Registration) markRegistered(environmentName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	registered := r.get(environmentName)
+	if !util.IsClosed(registered) {
+		close(registered)
+	}
+}
@@ -0,0 +1,42 @@
+package ping
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Registration(t *testing.T) {
+	registration := NewRegistration("dev", "prod")
+
+	assert.False(t, registration.IsRegistered("dev"))
+	assert.False(t, registration.IsAllRegistered())
+	assert.EqualError(t, registration.ReadyCheck(nil), "environments not yet registered with the riser server: dev, prod")
+
+	registration.markRegistered("dev")
+	registration.markRegistered("dev")
+
+	assert.True(t, registration.IsRegistered("dev"))
+	assert.False(t, registration.IsRegistered("prod"))
+	assert.EqualError(t, registration.ReadyCheck(nil), "environments not yet registered with the riser server: prod")
+	<-registration.Registered("dev")
+
+	registration.markRegistered("prod")
+
+	assert.True(t, registration.IsAllRegistered())
+	assert.NoError(t, registration.ReadyCheck(nil))
+}
+
+func Test_Registration_Nil(t *testing.T) {
+	var registration *Registration
+
+	assert.True(t, registration.IsRegistered("dev"))
+	assert.True(t, registration.IsAllRegistered())
+}
+
+func Test_nextBackoff(t *testing.T) {
+	assert.Equal(t, 2*time.Second, nextBackoff(time.Second))
+	assert.Equal(t, bootstrapMaxBackoff, nextBackoff(45*time.Second))
+	assert.Equal(t, bootstrapMaxBackoff, nextBackoff(bootstrapMaxBackoff))
+}
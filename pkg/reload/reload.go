@@ -0,0 +1,159 @@
+/*
+Package reload reloads selected settings from mounted Secret or ConfigMap volumes without restarting the controller. Each key is a file named
+after its environment variable (e.g. RISER_SERVER_APIKEY), so the same Secret or ConfigMap used for environment variables can be mounted.
+Files are polled rather than watched since the kubelet updates mounted volumes by swapping symlinks, which file watchers handle inconsistently.
+*/
+package reload
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+)
+
+const (
+	serverApikeyKey                    = "RISER_SERVER_APIKEY"
+	serverPingSecondsKey               = "RISER_SERVER_PING_SECONDS"
+	sealedsecretCertRefreshDurationKey = "RISER_SEALEDSECRET_CERT_REFRESH_DURATION"
+	secretKeyRefreshDurationKey        = "RISER_SECRET_KEY_REFRESH_DURATION"
+)
+
+// Settings are the settings that can be reloaded. Zero values are not set in any of the watched paths.
+type Settings struct {
+	ServerApikey                    string
+	ServerPingDuration              time.Duration
+	SealedsecretCertRefreshDuration time.Duration
+	SecretKeyRefreshDuration        time.Duration
+}
+
+type Watcher struct {
+	paths    []string
+	log      logr.Logger
+	current  Settings
+	onChange []func(Settings)
+}
+
+// NewWatcher creates a watcher for the directories in paths. A key found in more than one directory uses the value from the last directory.
+func NewWatcher(paths []string, log logr.Logger) *Watcher {
+	return &Watcher{paths: paths, log: log}
+}
+
+// Load loads the current settings. This should be called once on startup before the watcher is started.
+func (w *Watcher) Load() (Settings, error) {
+	settings, err := loadSettings(w.paths)
+	if err != nil {
+		return Settings{}, err
+	}
+	w.current = settings
+	return settings, nil
+}
+
+// OnChange registers a function that is called with the new settings whenever they change. Must be called before Start.
+func (w *Watcher) OnChange(fn func(Settings)) {
+	w.onChange = append(w.onChange, fn)
+}
+
+// Start polls the watched paths on an interval. Invalid settings are logged and ignored until they're fixed.
+func (w *Watcher) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			w.poll()
+		}
+	}()
+}
+
+func (w *Watcher) poll() {
+	settings, err := loadSettings(w.paths)
+	if err != nil {
+		w.log.Error(err, "Error reloading settings")
+		return
+	}
+	if settings == w.current {
+		return
+	}
+
+	w.log.Info("Settings changed. Reloading...", "changed", changedKeys(w.current, settings))
+	w.current = settings
+	for _, fn := range w.onChange {
+		fn(settings)
+	}
+}
+
+func loadSettings(paths []string) (Settings, error) {
+	values := map[string]string{}
+	for _, path := range paths {
+		for _, key := range []string{serverApikeyKey, serverPingSecondsKey, sealedsecretCertRefreshDurationKey, secretKeyRefreshDurationKey} {
+			value, err := ioutil.ReadFile(filepath.Join(path, key))
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return Settings{}, errors.Wrap(err, "Error reading setting")
+			}
+			values[key] = strings.TrimSpace(string(value))
+		}
+	}
+
+	return parseSettings(values)
+}
+
+func parseSettings(values map[string]string) (Settings, error) {
+	settings := Settings{ServerApikey: values[serverApikeyKey]}
+
+	if value := values[serverPingSecondsKey]; value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return Settings{}, errors.Errorf("Invalid %s: %q", serverPingSecondsKey, value)
+		}
+		settings.ServerPingDuration = time.Duration(seconds) * time.Second
+	}
+
+	var err error
+	settings.SealedsecretCertRefreshDuration, err = parseDuration(sealedsecretCertRefreshDurationKey, values)
+	if err != nil {
+		return Settings{}, err
+	}
+	settings.SecretKeyRefreshDuration, err = parseDuration(secretKeyRefreshDurationKey, values)
+	if err != nil {
+		return Settings{}, err
+	}
+
+	return settings, nil
+}
+
+func parseDuration(key string, values map[string]string) (time.Duration, error) {
+	value := values[key]
+	if value == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, errors.Errorf("Invalid %s: %q", key, value)
+	}
+	return duration, nil
+}
+
+// changedKeys returns the keys of the settings that changed. Values are not logged since they may be sensitive.
+func changedKeys(previous, current Settings) []string {
+	changed := []string{}
+	if previous.ServerApikey != current.ServerApikey {
+		changed = append(changed, serverApikeyKey)
+	}
+	if previous.ServerPingDuration != current.ServerPingDuration {
+		changed = append(changed, serverPingSecondsKey)
+	}
+	if previous.SealedsecretCertRefreshDuration != current.SealedsecretCertRefreshDuration {
+		changed = append(changed, sealedsecretCertRefreshDurationKey)
+	}
+	if previous.SecretKeyRefreshDuration != current.SecretKeyRefreshDuration {
+		changed = append(changed, secretKeyRefreshDurationKey)
+	}
+	return changed
+}
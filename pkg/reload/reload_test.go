@@ -0,0 +1,94 @@
+package reload
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseSettings(t *testing.T) {
+	tests := []struct {
+		name        string
+		values      map[string]string
+		expected    Settings
+		expectedErr string
+	}{
+		{"empty", map[string]string{}, Settings{}, ""},
+		{
+			"all settings",
+			map[string]string{
+				serverApikeyKey:                    "key",
+				serverPingSecondsKey:               "5",
+				sealedsecretCertRefreshDurationKey: "1h",
+				secretKeyRefreshDurationKey:        "10m",
+			},
+			Settings{ServerApikey: "key", ServerPingDuration: 5 * time.Second, SealedsecretCertRefreshDuration: time.Hour, SecretKeyRefreshDuration: 10 * time.Minute},
+			"",
+		},
+		{"invalid ping seconds", map[string]string{serverPingSecondsKey: "five"}, Settings{}, `Invalid RISER_SERVER_PING_SECONDS: "five"`},
+		{"zero ping seconds", map[string]string{serverPingSecondsKey: "0"}, Settings{}, `Invalid RISER_SERVER_PING_SECONDS: "0"`},
+		{"invalid duration", map[string]string{secretKeyRefreshDurationKey: "1d"}, Settings{}, `Invalid RISER_SECRET_KEY_REFRESH_DURATION: "1d"`},
+	}
+
+	for _, tt := range tests {
+		result, err := parseSettings(tt.values)
+		if tt.expectedErr == "" {
+			assert.NoError(t, err, "when %s", tt.name)
+		} else {
+			assert.EqualError(t, err, tt.expectedErr, "when %s", tt.name)
+		}
+		assert.Equal(t, tt.expected, result, "when %s", tt.name)
+	}
+}
+
+func Test_loadSettings(t *testing.T) {
+	secretDir := t.TempDir()
+	configDir := t.TempDir()
+	writeSetting(t, secretDir, serverApikeyKey, "key\n")
+	writeSetting(t, secretDir, serverPingSecondsKey, "5")
+	writeSetting(t, configDir, serverPingSecondsKey, "15")
+
+	result, err := loadSettings([]string{secretDir, configDir, filepath.Join(configDir, "missing")})
+
+	assert.NoError(t, err)
+	assert.Equal(t, Settings{ServerApikey: "key", ServerPingDuration: 15 * time.Second}, result)
+}
+
+func Test_Watcher_poll(t *testing.T) {
+	dir := t.TempDir()
+	writeSetting(t, dir, serverApikeyKey, "key")
+	watcher := NewWatcher([]string{dir}, logr.Discard())
+	changes := []Settings{}
+	watcher.OnChange(func(settings Settings) {
+		changes = append(changes, settings)
+	})
+	_, err := watcher.Load()
+	require.NoError(t, err)
+
+	watcher.poll()
+	assert.Empty(t, changes)
+
+	writeSetting(t, dir, serverApikeyKey, "rotated")
+	watcher.poll()
+	assert.Equal(t, []Settings{{ServerApikey: "rotated"}}, changes)
+
+	writeSetting(t, dir, serverPingSecondsKey, "invalid")
+	watcher.poll()
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "rotated", watcher.current.ServerApikey)
+}
+
+func Test_changedKeys(t *testing.T) {
+	result := changedKeys(Settings{ServerApikey: "key", ServerPingDuration: time.Second}, Settings{ServerApikey: "rotated", ServerPingDuration: time.Second})
+
+	assert.Equal(t, []string{serverApikeyKey}, result)
+}
+
+func writeSetting(t *testing.T, dir, key, value string) {
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, key), []byte(value), 0600))
+}
@@ -1,11 +1,14 @@
 package runtime
 
+import "github.com/pkg/errors"
+
 // Config provides minimal config to spin up the server. The env var name is prefixed with split words (e.g. ServerURL = RISER_SERVER_URL)
 type Config struct {
 	/* Required  */
-	ServerURL    string `split_words:"true" required:"true"`
-	ServerApikey string `split_words:"true" required:"true"`
-	Environment  string `split_words:"true" required:"true"`
+	ServerURL   string `split_words:"true" required:"true"`
+	Environment string `split_words:"true" required:"true"`
+	// ServerApikey is required unless ServerCredentialEnabled is true
+	ServerApikey string `split_words:"true"`
 
 	/* Optional */
 	ServerPingSeconds               int    `split_words:"true" default:"10"`
@@ -13,4 +16,101 @@ type Config struct {
 	SealedsecretControllerName      string `split_words:"true" default:"sealed-secrets-controller"`
 	SealedsecretNamespace           string `split_words:"true" default:"kube-system"`
 	SealedsecretCertRefreshDuration string `split_words:"true" default:"24h"`
+	// SealedsecretControllers supports multiple sealed secret controllers. Takes precedence over SealedsecretControllerName and SealedsecretNamespace.
+	SealedsecretControllers SealedSecretControllers `split_words:"true"`
+	// SealedsecretCertFetchMode is one of "proxy" (API server service proxy), "direct" (cluster network) or "file"
+	SealedsecretCertFetchMode string `split_words:"true" default:"proxy"`
+	SealedsecretCertScheme    string `split_words:"true" default:"http"`
+	// SealedsecretCertPort is the sealed secret controller's service port name or number. Defaults to the first service port in "proxy" mode and
+	// 8080 in "direct" mode.
+	SealedsecretCertPort       string `split_words:"true"`
+	SealedsecretCertPath       string `split_words:"true" default:"/v1/cert.pem"`
+	SealedsecretCertCaFile     string `split_words:"true"`
+	SealedsecretCertFile       string `split_words:"true"`
+	SealedsecretCertMinKeyBits int    `split_words:"true" default:"2048"`
+	// SealedsecretCertCommonName is the expected subject common name of the sealed secret cert. Not validated when empty.
+	SealedsecretCertCommonName string `split_words:"true"`
+	// SealedsecretKeyWatchEnabled refreshes the cert as soon as the sealed secret controller rotates its key. Requires list and watch access to
+	// secrets in each controller's namespace (see config/rbac/sealedsecret_key_role.yaml), which also allows reading the private keys.
+	SealedsecretKeyWatchEnabled bool `split_words:"true" default:"false"`
+	// SecretKeyRefreshDuration is the refresh interval for secret key providers other than sealed secrets
+	SecretKeyRefreshDuration string `split_words:"true" default:"1h"`
+	// SopsEnabled publishes SOPS age and PGP recipients from a ConfigMap
+	SopsEnabled            bool   `split_words:"true" default:"false"`
+	SopsConfigmapName      string `split_words:"true" default:"riser-sops"`
+	SopsConfigmapNamespace string `split_words:"true" default:"riser-system"`
+	// ExternalSecretsEnabled reports the External Secrets Operator secret stores in the cluster
+	ExternalSecretsEnabled    bool   `split_words:"true" default:"false"`
+	ExternalSecretsApiVersion string `split_words:"true" default:"external-secrets.io/v1beta1"`
+	// DomainMappingEnabled reports knative domain mappings. Disable if the DomainMapping CRD is not installed.
+	DomainMappingEnabled bool `split_words:"true" default:"true"`
+	// RevisionStatusLimit is the number of most recent revisions reported in addition to revisions receiving traffic. Zero reports all revisions.
+	RevisionStatusLimit int `split_words:"true" default:"0"`
+	// RevisionGcReportEnabled reports when knative will garbage collect each revision
+	RevisionGcReportEnabled bool `split_words:"true" default:"false"`
+	// ServerCredentialEnabled uses a cluster credential stored in a Secret instead of ServerApikey. When the Secret does not exist the
+	// ServerRegistrationToken is exchanged for a new cluster credential.
+	ServerCredentialEnabled          bool   `split_words:"true" default:"false"`
+	ServerRegistrationToken          string `split_words:"true"`
+	ServerCredentialSecretName       string `split_words:"true" default:"riser-controller-credential"`
+	ServerCredentialSecretNamespace  string `split_words:"true" default:"riser-system"`
+	ServerCredentialRotationDuration string `split_words:"true" default:"168h"`
+	// ReloadPaths are directories (e.g. a mounted Secret or ConfigMap) containing settings that are reloaded without a restart. See package reload.
+	ReloadPaths         []string `split_words:"true"`
+	ReloadCheckDuration string   `split_words:"true" default:"30s"`
+	// ServerCaFile, ServerClientCertFile and ServerClientKeyFile are PEM files for connecting to the riser server with a private CA or mutual TLS
+	ServerCaFile         string `split_words:"true"`
+	ServerClientCertFile string `split_words:"true"`
+	ServerClientKeyFile  string `split_words:"true"`
+	// ServerTlsMinVersion is "1.2" or "1.3"
+	ServerTlsMinVersion string `split_words:"true" default:"1.2"`
+	// ServerProxyURL is the HTTP proxy for the riser server. Defaults to the standard proxy environment variables.
+	ServerProxyURL string `split_words:"true"`
+	// ServerQps and ServerBurst limit all requests to the riser server, including the reconciles of every deployment on startup and on each
+	// resync. Keep them below the riser server's rate limit. Zero ServerQps disables the limit.
+	ServerQps   float64 `split_words:"true" default:"10"`
+	ServerBurst int     `split_words:"true" default:"100"`
+	// EnvironmentNamespaceLabel and EnvironmentNamespaceAnnotation map a namespace to a riser environment (multi-environment mode). Namespaces
+	// without a mapping belong to Environment. AdditionalEnvironments are the other environments managed by the controller.
+	EnvironmentNamespaceLabel      string   `split_words:"true"`
+	EnvironmentNamespaceAnnotation string   `split_words:"true"`
+	AdditionalEnvironments         []string `split_words:"true"`
+	// WatchNamespaces and WatchNamespaceSelector (a namespace label selector) restrict the controller to the riser namespaces in large shared
+	// clusters. All namespaces are watched when neither are specified.
+	WatchNamespaces        []string `split_words:"true"`
+	WatchNamespaceSelector string   `split_words:"true"`
+	// CacheSelectorsEnabled only caches knative and riser objects rather than every Deployment, Configuration, Route and ConfigMap (see
+	// controllers.CacheSelectors)
+	CacheSelectorsEnabled bool `split_words:"true" default:"true"`
+	// ReconcileMaxConcurrent is the number of reconciles run in parallel by each controller
+	ReconcileMaxConcurrent int `split_words:"true" default:"1"`
+	// ReconcileRetryBaseDuration and ReconcileRetryMaxDuration bound the exponential backoff of each failed reconcile. ReconcileRetryQps and
+	// ReconcileRetryBurst limit retries across all controllers and should be kept below the riser server's rate limit.
+	ReconcileRetryBaseDuration string  `split_words:"true" default:"5ms"`
+	ReconcileRetryMaxDuration  string  `split_words:"true" default:"5m"`
+	ReconcileRetryQps          float64 `split_words:"true" default:"10"`
+	ReconcileRetryBurst        int     `split_words:"true" default:"100"`
+	// StatusBatchDuration is how long deployment statuses are collected before they're saved in a single request. Zero saves each status
+	// as soon as it's reconciled.
+	StatusBatchDuration string `split_words:"true" default:"1s"`
+}
+
+// Validate validates config that envconfig can't
+func (c *Config) Validate() error {
+	if c.ServerApikey == "" && !c.ServerCredentialEnabled {
+		return errors.New("RISER_SERVER_APIKEY is required unless RISER_SERVER_CREDENTIAL_ENABLED is true")
+	}
+	if len(c.AdditionalEnvironments) > 0 && c.EnvironmentNamespaceLabel == "" && c.EnvironmentNamespaceAnnotation == "" {
+		return errors.New("RISER_ADDITIONAL_ENVIRONMENTS requires RISER_ENVIRONMENT_NAMESPACE_LABEL or RISER_ENVIRONMENT_NAMESPACE_ANNOTATION")
+	}
+	if c.ReconcileMaxConcurrent < 1 {
+		return errors.New("RISER_RECONCILE_MAX_CONCURRENT must be at least 1")
+	}
+	if c.ServerQps < 0 || (c.ServerQps > 0 && c.ServerBurst < 1) {
+		return errors.New("RISER_SERVER_QPS must not be negative and RISER_SERVER_BURST must be at least 1")
+	}
+	if c.ReconcileRetryQps <= 0 || c.ReconcileRetryBurst < 1 {
+		return errors.New("RISER_RECONCILE_RETRY_QPS must be greater than 0 and RISER_RECONCILE_RETRY_BURST must be at least 1")
+	}
+	return nil
 }
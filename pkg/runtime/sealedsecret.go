@@ -0,0 +1,40 @@
+package runtime
+
+import (
+	"encoding/json"
+)
+
+// SealedSecretController identifies a sealed secret controller by name or identifies one or more controllers by a label selector on the
+// controller's service. An empty namespace with a selector selects controllers in all namespaces.
+type SealedSecretController struct {
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Selector  string `json:"selector,omitempty"`
+	// Namespaces and Apps are the riser namespaces and apps whose secrets are sealed with the controller's cert. The cert of a controller without
+	// any namespaces or apps is used as the default for the environment.
+	Namespaces []string `json:"namespaces,omitempty"`
+	Apps       []string `json:"apps,omitempty"`
+	// CertFile is the controller's cert file when using the "file" cert fetch mode
+	CertFile string `json:"certFile,omitempty"`
+	// Environments are the riser environments that the controller's cert is published to in multi-environment mode. All environments when empty.
+	Environments []string `json:"environments,omitempty"`
+}
+
+// SealedSecretControllers is decoded from a JSON array
+// (e.g. RISER_SEALEDSECRET_CONTROLLERS='[{"name":"sealed-secrets-controller","namespace":"tenant-a","namespaces":["tenant-a"]}]')
+type SealedSecretControllers []SealedSecretController
+
+func (c *SealedSecretControllers) Decode(value string) error {
+	return json.Unmarshal([]byte(value), c)
+}
+
+// GetSealedSecretControllers returns the configured sealed secret controllers. Defaults to the single controller specified by
+// SealedsecretControllerName and SealedsecretNamespace.
+func (c *Config) GetSealedSecretControllers() []SealedSecretController {
+	if len(c.SealedsecretControllers) > 0 {
+		return c.SealedsecretControllers
+	}
+	return []SealedSecretController{
+		{Name: c.SealedsecretControllerName, Namespace: c.SealedsecretNamespace},
+	}
+}
@@ -0,0 +1,39 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SealedSecretControllers_Decode(t *testing.T) {
+	controllers := SealedSecretControllers{}
+
+	err := controllers.Decode(`[{"name":"tenant-a","namespace":"tenant-a","namespaces":["ns-a"]},{"selector":"app=sealed-secrets","apps":["myapp"]}]`)
+
+	require.NoError(t, err)
+	assert.Equal(t, SealedSecretControllers{
+		{Name: "tenant-a", Namespace: "tenant-a", Namespaces: []string{"ns-a"}},
+		{Selector: "app=sealed-secrets", Apps: []string{"myapp"}},
+	}, controllers)
+}
+
+func Test_GetSealedSecretControllers_Default(t *testing.T) {
+	config := &Config{
+		SealedsecretControllerName: "sealed-secrets-controller",
+		SealedsecretNamespace:      "kube-system",
+	}
+
+	assert.Equal(t, []SealedSecretController{{Name: "sealed-secrets-controller", Namespace: "kube-system"}}, config.GetSealedSecretControllers())
+}
+
+func Test_GetSealedSecretControllers(t *testing.T) {
+	config := &Config{
+		SealedsecretControllerName: "sealed-secrets-controller",
+		SealedsecretNamespace:      "kube-system",
+		SealedsecretControllers:    SealedSecretControllers{{Name: "tenant-a", Namespace: "tenant-a"}},
+	}
+
+	assert.Equal(t, []SealedSecretController{{Name: "tenant-a", Namespace: "tenant-a"}}, config.GetSealedSecretControllers())
+}
@@ -0,0 +1,65 @@
+package sealedsecret
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CertValidation are the requirements for a sealed secret cert to be published to the riser server
+type CertValidation struct {
+	// MinKeyBits is the minimum size of the RSA public key
+	MinKeyBits int
+	// CommonName is the expected subject common name of the cert. Ignored when empty.
+	CommonName string
+}
+
+// parseCert parses and validates a PEM encoded sealed secret cert. The sealed secret controller serves a self signed cert so only the cert
+// itself is validated and not the chain.
+func parseCert(certBytes []byte, validation CertValidation, now time.Time) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certBytes)
+	if block == nil {
+		return nil, errors.New("Unable to decode PEM: the response does not contain a certificate")
+	}
+	if block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("Expected PEM block of type \"CERTIFICATE\" but found %q", block.Type)
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to parse certificate")
+	}
+
+	if now.Before(cert.NotBefore) {
+		return nil, fmt.Errorf("Certificate is not valid until %s", cert.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(cert.NotAfter) {
+		return nil, fmt.Errorf("Certificate expired on %s", cert.NotAfter.Format(time.RFC3339))
+	}
+
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("Expected an RSA public key but found %T", cert.PublicKey)
+	}
+	if publicKey.N.BitLen() < validation.MinKeyBits {
+		return nil, fmt.Errorf("RSA public key size %d is less than the minimum of %d", publicKey.N.BitLen(), validation.MinKeyBits)
+	}
+
+	if validation.CommonName != "" && cert.Subject.CommonName != validation.CommonName {
+		return nil, fmt.Errorf("Expected certificate common name %q but found %q", validation.CommonName, cert.Subject.CommonName)
+	}
+
+	return cert, nil
+}
+
+// fingerprint returns the hex encoded SHA-256 fingerprint of the cert
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,106 @@
+package sealedsecret
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func Test_parseCert(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	certBytes := createTestCert(t, key, &key.PublicKey, "sealed-secret", now.Add(-time.Hour), now.Add(time.Hour))
+
+	cert, err := parseCert(certBytes, CertValidation{MinKeyBits: 2048, CommonName: "sealed-secret"}, now)
+
+	require.NoError(t, err)
+	assert.Equal(t, "sealed-secret", cert.Subject.CommonName)
+	assert.Len(t, fingerprint(cert), 64)
+}
+
+func Test_parseCert_Invalid(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name        string
+		certBytes   []byte
+		validation  CertValidation
+		expectedErr string
+	}{
+		{
+			name:        "empty",
+			certBytes:   []byte{},
+			expectedErr: "Unable to decode PEM: the response does not contain a certificate",
+		},
+		{
+			name:        "html",
+			certBytes:   []byte("<html><body>503 Service Unavailable</body></html>"),
+			expectedErr: "Unable to decode PEM: the response does not contain a certificate",
+		},
+		{
+			name:        "not a certificate",
+			certBytes:   pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte{}}),
+			expectedErr: `Expected PEM block of type "CERTIFICATE" but found "PUBLIC KEY"`,
+		},
+		{
+			name:        "expired",
+			certBytes:   createTestCert(t, key, &key.PublicKey, "", now.Add(-2*time.Hour), now.Add(-time.Hour)),
+			expectedErr: "Certificate expired on 2021-05-31T23:00:00Z",
+		},
+		{
+			name:        "not yet valid",
+			certBytes:   createTestCert(t, key, &key.PublicKey, "", now.Add(time.Hour), now.Add(2*time.Hour)),
+			expectedErr: "Certificate is not valid until 2021-06-01T01:00:00Z",
+		},
+		{
+			name:        "not RSA",
+			certBytes:   createTestCert(t, ecKey, &ecKey.PublicKey, "", now.Add(-time.Hour), now.Add(time.Hour)),
+			expectedErr: "Expected an RSA public key but found *ecdsa.PublicKey",
+		},
+		{
+			name:        "key too small",
+			certBytes:   createTestCert(t, key, &key.PublicKey, "", now.Add(-time.Hour), now.Add(time.Hour)),
+			validation:  CertValidation{MinKeyBits: 4096},
+			expectedErr: "RSA public key size 2048 is less than the minimum of 4096",
+		},
+		{
+			name:        "unexpected common name",
+			certBytes:   createTestCert(t, key, &key.PublicKey, "other", now.Add(-time.Hour), now.Add(time.Hour)),
+			validation:  CertValidation{CommonName: "sealed-secret"},
+			expectedErr: `Expected certificate common name "sealed-secret" but found "other"`,
+		},
+	}
+
+	for _, test := range tt {
+		cert, err := parseCert(test.certBytes, test.validation, now)
+		assert.Nil(t, cert, "when %s", test.name)
+		assert.EqualError(t, err, test.expectedErr, "when %s", test.name)
+	}
+}
+
+func createTestCert(t *testing.T, signer interface{}, publicKey interface{}, commonName string, notBefore, notAfter time.Time) []byte {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, publicKey, signer)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -0,0 +1,138 @@
+package sealedsecret
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1Client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// FetchModeProxy retrieves the cert through the kubernetes API server service proxy. Requires access to services/proxy.
+	FetchModeProxy = "proxy"
+	// FetchModeDirect retrieves the cert directly from the controller's service using the cluster network
+	FetchModeDirect = "direct"
+	// FetchModeFile reads the cert from a file (e.g. a mounted ConfigMap) for air-gapped bootstrapping
+	FetchModeFile = "file"
+
+	defaultDirectPort = "8080"
+	fetchTimeout      = 30 * time.Second
+)
+
+// CertEndpoint configures how the cert is retrieved from the sealed secret controller
+type CertEndpoint struct {
+	Mode   string
+	Scheme string
+	// Port is the service port name or number. Defaults to the first service port in proxy mode and 8080 in direct mode.
+	Port string
+	Path string
+	// CAFile is the CA bundle used to verify the controller's cert in direct mode with https. Defaults to the system CA bundle.
+	CAFile string
+	// File is the cert file used in file mode when the controller does not specify its own file
+	File string
+}
+
+type certFetcher interface {
+	fetch(target controllerTarget) ([]byte, error)
+}
+
+func newCertFetcher(endpoint CertEndpoint, kubeClient *corev1Client.CoreV1Client) (certFetcher, error) {
+	switch endpoint.Mode {
+	case FetchModeProxy, "":
+		return &proxyFetcher{endpoint, kubeClient}, nil
+	case FetchModeDirect:
+		httpClient, err := newHTTPClient(endpoint.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		return &directFetcher{endpoint, httpClient}, nil
+	case FetchModeFile:
+		return &fileFetcher{endpoint}, nil
+	default:
+		return nil, fmt.Errorf("Invalid sealed secret cert fetch mode %q. Must be one of: %s, %s, %s", endpoint.Mode, FetchModeProxy, FetchModeDirect, FetchModeFile)
+	}
+}
+
+type proxyFetcher struct {
+	endpoint   CertEndpoint
+	kubeClient *corev1Client.CoreV1Client
+}
+
+func (f *proxyFetcher) fetch(target controllerTarget) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	return f.kubeClient.Services(target.namespace).
+		ProxyGet(f.endpoint.Scheme, target.name, f.endpoint.Port, f.endpoint.Path, nil).
+		DoRaw(ctx)
+}
+
+type directFetcher struct {
+	endpoint   CertEndpoint
+	httpClient *http.Client
+}
+
+func (f *directFetcher) fetch(target controllerTarget) ([]byte, error) {
+	return f.fetchURL(getDirectURL(f.endpoint, target))
+}
+
+func (f *directFetcher) fetchURL(url string) ([]byte, error) {
+	response, err := f.httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected status code %d", response.StatusCode)
+	}
+	return ioutil.ReadAll(response.Body)
+}
+
+func getDirectURL(endpoint CertEndpoint, target controllerTarget) string {
+	port := endpoint.Port
+	if port == "" {
+		port = defaultDirectPort
+	}
+	return fmt.Sprintf("%s://%s.%s.svc:%s%s", endpoint.Scheme, target.name, target.namespace, port, endpoint.Path)
+}
+
+func newHTTPClient(caFile string) (*http.Client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		caBytes, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to read sealed secret CA file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("No certificates found in sealed secret CA file %q", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &http.Client{
+		Timeout:   fetchTimeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}, nil
+}
+
+type fileFetcher struct {
+	endpoint CertEndpoint
+}
+
+func (f *fileFetcher) fetch(target controllerTarget) ([]byte, error) {
+	file := target.certFile
+	if file == "" {
+		file = f.endpoint.File
+	}
+	if file == "" {
+		return nil, errors.New("No cert file specified")
+	}
+	return ioutil.ReadFile(file)
+}
@@ -0,0 +1,104 @@
+package sealedsecret
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newCertFetcher_InvalidMode(t *testing.T) {
+	fetcher, err := newCertFetcher(CertEndpoint{Mode: "lol"}, nil)
+
+	assert.Nil(t, fetcher)
+	assert.EqualError(t, err, `Invalid sealed secret cert fetch mode "lol". Must be one of: proxy, direct, file`)
+}
+
+func Test_getDirectURL(t *testing.T) {
+	target := controllerTarget{name: "sealed-secrets-controller", namespace: "kube-system"}
+
+	assert.Equal(t, "http://sealed-secrets-controller.kube-system.svc:8080/v1/cert.pem",
+		getDirectURL(CertEndpoint{Scheme: "http", Path: "/v1/cert.pem"}, target))
+	assert.Equal(t, "https://sealed-secrets-controller.kube-system.svc:8443/v1/cert.pem",
+		getDirectURL(CertEndpoint{Scheme: "https", Port: "8443", Path: "/v1/cert.pem"}, target))
+}
+
+func Test_directFetcher_WithCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/cert.pem", r.URL.Path)
+		_, _ = w.Write([]byte("cert"))
+	}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+	require.NoError(t, err)
+
+	httpClient, err := newHTTPClient(caFile)
+	require.NoError(t, err)
+	fetcher := &directFetcher{httpClient: httpClient}
+
+	result, err := fetcher.fetchURL(server.URL + "/v1/cert.pem")
+
+	require.NoError(t, err)
+	assert.Equal(t, []byte("cert"), result)
+}
+
+func Test_directFetcher_UntrustedCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	httpClient, err := newHTTPClient("")
+	require.NoError(t, err)
+	fetcher := &directFetcher{httpClient: httpClient}
+
+	_, err = fetcher.fetchURL(server.URL + "/v1/cert.pem")
+
+	assert.Error(t, err)
+}
+
+func Test_directFetcher_StatusCode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	httpClient, err := newHTTPClient("")
+	require.NoError(t, err)
+	fetcher := &directFetcher{httpClient: httpClient}
+
+	_, err = fetcher.fetchURL(server.URL)
+
+	assert.EqualError(t, err, "Unexpected status code 503")
+}
+
+func Test_newHTTPClient_InvalidCAFile(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := ioutil.WriteFile(caFile, []byte("not a cert"), 0600)
+	require.NoError(t, err)
+
+	_, err = newHTTPClient(caFile)
+
+	assert.EqualError(t, err, `No certificates found in sealed secret CA file "`+caFile+`"`)
+}
+
+func Test_fileFetcher(t *testing.T) {
+	dir := t.TempDir()
+	defaultFile := filepath.Join(dir, "default.pem")
+	controllerFile := filepath.Join(dir, "controller.pem")
+	require.NoError(t, ioutil.WriteFile(defaultFile, []byte("default"), 0600))
+	require.NoError(t, ioutil.WriteFile(controllerFile, []byte("controller"), 0600))
+	fetcher := &fileFetcher{CertEndpoint{File: defaultFile}}
+
+	result, err := fetcher.fetch(controllerTarget{})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("default"), result)
+
+	result, err = fetcher.fetch(controllerTarget{certFile: controllerFile})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("controller"), result)
+}
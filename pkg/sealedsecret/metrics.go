@@ -0,0 +1,21 @@
+package sealedsecret
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	certExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "riser_sealedsecret_cert_expiry_timestamp_seconds",
+		Help: "The expiry time of the last valid cert retrieved from the sealed secret controller",
+	}, []string{"controller", "namespace"})
+	certValid = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "riser_sealedsecret_cert_valid",
+		Help: "1 if the last cert retrieved from the sealed secret controller was valid, otherwise 0",
+	}, []string{"controller", "namespace"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(certExpiry, certValid)
+}
@@ -2,91 +2,292 @@ package sealedsecret
 
 import (
 	"context"
+	"fmt"
+	"riser-controller/pkg/api"
+	"riser-controller/pkg/runtime"
+	"riser-controller/pkg/util"
 	"time"
 
-	"github.com/riser-platform/riser-server/pkg/sdk"
-
 	"github.com/riser-platform/riser-server/api/v1/model"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	corev1Client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 )
 
-const retryOnFailureSeconds = 5 * time.Second
+// keyLabel is the label that the sealed secrets controller applies to the secrets containing its keys
+const keyLabel = "sealedsecrets.bitnami.com/sealed-secrets-key"
+
+// Provider is a secretkey.Provider for the sealed secret controller's cert (public key)
+type Provider struct {
+	controllers    []runtime.SealedSecretController
+	log            logr.Logger
+	certValidation CertValidation
+	watchEnabled   bool
+	kubeConfig     *rest.Config
+	kubeClient     *corev1Client.CoreV1Client
+	fetcher        certFetcher
+	// certs are the last good certs keyed by controller namespace/name
+	certs map[string]api.SealedSecretCert
+	// certEnvironments are the environments of each cert keyed by controller namespace/name. See ForEnvironment.
+	certEnvironments map[string][]string
+}
 
-type refresher struct {
-	environmentName     string
-	controllerName      string
-	controllerNamespace string
-	log                 logr.Logger
-	ticker              *time.Ticker
-	kubeClient          *corev1Client.CoreV1Client
-	riserClient         *sdk.Client
+// controllerTarget is a resolved sealed secret controller
+type controllerTarget struct {
+	name         string
+	namespace    string
+	namespaces   []string
+	apps         []string
+	certFile     string
+	environments []string
 }
 
 /*
-	StartCertRefresher polls the sealed secret controller on an interval and updates the riser server with the latest cert (public key)
-	This is not a controller because the only resources we can monitor are secrets which include the private key. Riser should never have access
-	to the private key. The only way to safely get the public key is with access to the sealed secret API. Additionally, it is not critical
-	that the key is refreshed at the same time that it is rotated within the sealed secret controller.  The goal is
-	to rotate the key within N duration. At the time of writing the default sealed secret rotation is set to 30 days, and the refresh duration is set
-	to 1 day. This means that for a period of a maximum of 1 day that new secrets stored via Riser will still use the old key. This is perfectly
-	valid. The sealed secrets controller maintains a history of keys and will not delete them. If for some reason you need keys rotated within 30
-	days, it's better to configure the sealed secrets controller to a shorter duration (e.g. 15 days) than to change the refresh frequency.
-
-	If timely cert refreshing is critical it's important to setup monitoring. Errors other than on startup are logged but are not considered fatal.
-	Other operations such	as reporting status should not be affected. The only case where this is truly is when there is a new environment that does not
-	have any cert, in	which case no secrets can be saved.
-
-	Read https://github.com/bitnami-labs/sealed-secrets#secret-rotation for more info.
+NewProvider creates a provider that gets the latest cert (public key) from the sealed secret controller. The provider is polled on an interval.
+The cert is always retrieved from the sealed secret API (or a cert file) since the key secrets also contain the private key, which Riser should
+never read. Watching the key secrets is optional (see watchKeys below) and only ever reads their metadata to learn when to refresh.
+It is not critical that the key is refreshed at the same time that it is rotated within the sealed secret controller. The goal is
+to rotate the key within N duration. At the time of writing the default sealed secret rotation is set to 30 days, and the refresh duration is set
+to 1 day. This means that for a period of a maximum of 1 day that new secrets stored via Riser will still use the old key. This is perfectly
+valid. The sealed secrets controller maintains a history of keys and will not delete them. If for some reason you need keys rotated within 30
+days, it's better to configure the sealed secrets controller to a shorter duration (e.g. 15 days) than to change the refresh frequency.
+
+If timely cert refreshing is critical it's important to setup monitoring. Errors other than on startup are logged but are not considered fatal.
+Other operations such	as reporting status should not be affected. The only case where this is truly is when there is a new environment that does not
+have any cert, in	which case no secrets can be saved.
+
+When watchKeys is enabled the key secrets are also watched so that the cert is refreshed as soon as a key is rotated. Only the metadata of
+the key secrets is watched so that the private key is never read by the controller. However, RBAC can't limit access to metadata, so the
+list and watch access that this requires (see config/rbac/sealedsecret_key_role.yaml) allows reading every secret in the controller's
+namespace, including the private keys. The refresh interval remains as a fallback.
+
+Multiple controllers (e.g. a controller per tenant) are supported. The certs of all controllers are published together along with the
+riser namespaces and apps that each controller seals secrets for.
+
+By default the cert is retrieved through the kubernetes API server service proxy. See CertEndpoint for alternatives when the API server can't
+reach the service network or access to services/proxy is not allowed.
+
+The cert is validated before it is published. An invalid cert (e.g. an error page returned by a proxy) is never published. The last good
+cert for the controller is published instead so that a good cert on the server is not overwritten.
+
+Read https://github.com/bitnami-labs/sealed-secrets#secret-rotation for more info.
 */
-func StartCertRefresher(kubeConfig *rest.Config, riserClient *sdk.Client, environmentName string, controllerName string, controllerNamespace string, refreshInterval time.Duration, log logr.Logger) error {
+func NewProvider(kubeConfig *rest.Config, controllers []runtime.SealedSecretController, certEndpoint CertEndpoint, watchKeys bool, certValidation CertValidation, log logr.Logger) (*Provider, error) {
 	client, err := corev1Client.NewForConfig(kubeConfig)
 	if err != nil {
-		return errors.Wrap(err, "Unable to create rest client for sealed secret cert refresher")
+		return nil, errors.Wrap(err, "Unable to create rest client for sealed secret cert refresher")
 	}
-	refresher := refresher{
-		environmentName:     environmentName,
-		controllerName:      controllerName,
-		controllerNamespace: controllerNamespace,
-		log:                 log,
-		kubeClient:          client,
-		ticker:              time.NewTicker(refreshInterval),
-		riserClient:         riserClient,
+	fetcher, err := newCertFetcher(certEndpoint, client)
+	if err != nil {
+		return nil, err
 	}
+	return &Provider{
+		fetcher:          fetcher,
+		controllers:      controllers,
+		log:              log,
+		certValidation:   certValidation,
+		watchEnabled:     watchKeys,
+		kubeConfig:       kubeConfig,
+		kubeClient:       client,
+		certs:            map[string]api.SealedSecretCert{},
+		certEnvironments: map[string][]string{},
+	}, nil
+}
 
-	refresher.refresh()
-	refresher.start()
+func (p *Provider) Name() string {
+	return "sealedsecret"
+}
+
+// Watch watches the key secrets of every controller when watchKeys is enabled
+func (p *Provider) Watch(refresh func()) error {
+	if !p.watchEnabled {
+		return nil
+	}
+	metadataClient, err := metadata.NewForConfig(p.kubeConfig)
+	if err != nil {
+		return errors.Wrap(err, "Unable to create metadata client for sealed secret key watch")
+	}
+	for _, namespace := range getWatchNamespaces(p.controllers) {
+		err = p.watchKeys(metadataClient, namespace, refresh, wait.NeverStop)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (r *refresher) start() {
-	go func() {
-		for {
-			<-r.ticker.C
-			r.refresh()
+// getWatchNamespaces returns the distinct namespaces of the controllers. Returns only metav1.NamespaceAll if any controller is selected from
+// all namespaces.
+func getWatchNamespaces(controllers []runtime.SealedSecretController) []string {
+	namespaces := []string{}
+	seen := map[string]bool{}
+	for _, controller := range controllers {
+		if controller.Namespace == metav1.NamespaceAll {
+			return []string{metav1.NamespaceAll}
 		}
-	}()
+		if !seen[controller.Namespace] {
+			seen[controller.Namespace] = true
+			namespaces = append(namespaces, controller.Namespace)
+		}
+	}
+	return namespaces
 }
 
-func (r *refresher) refresh() {
-	certBytes, err := r.kubeClient.Services(r.controllerNamespace).
-		ProxyGet("http", r.controllerName, "", "/v1/cert.pem", nil).
-		DoRaw(context.TODO())
-	config := &model.EnvironmentConfig{
-		SealedSecretCert: certBytes,
+// watchKeys triggers a refresh whenever a key secret is added or changed. Keys that existed when the watch started are ignored since the cert
+// was refreshed on startup. They are listed before the informer is started rather than relying on the informer's sync state, since the events
+// for the initial list can be handled after the informer reports that it has synced.
+func (p *Provider) watchKeys(metadataClient metadata.Interface, namespace string, refresh func(), stopCh <-chan struct{}) error {
+	secretsResource := corev1.SchemeGroupVersion.WithResource("secrets")
+	existing, err := metadataClient.Resource(secretsResource).Namespace(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: keyLabel})
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Error listing sealed secret keys in namespace %q", namespace))
 	}
+	existingKeys := map[types.UID]bool{}
+	for _, key := range existing.Items {
+		existingKeys[key.UID] = true
+	}
+
+	factory := metadatainformer.NewFilteredSharedInformerFactory(metadataClient, 0, namespace, func(options *metav1.ListOptions) {
+		options.LabelSelector = keyLabel
+	})
+	informer := factory.ForResource(secretsResource).Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if meta, ok := obj.(metav1.Object); ok && !existingKeys[meta.GetUID()] {
+				p.logKeyEvent("Sealed secret key added", obj)
+				refresh()
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if oldObj.(metav1.Object).GetResourceVersion() != newObj.(metav1.Object).GetResourceVersion() {
+				p.logKeyEvent("Sealed secret key updated", newObj)
+				refresh()
+			}
+		},
+	})
+
+	factory.Start(stopCh)
+	return nil
+}
 
-	if err == nil {
-		r.log.Info("Updating cert for sealed secrets")
-		err = r.riserClient.Environments.SetConfig(r.environmentName, config)
+func (p *Provider) logKeyEvent(msg string, obj interface{}) {
+	if meta, ok := obj.(metav1.Object); ok {
+		p.log.Info(msg, "name", meta.GetName(), "namespace", meta.GetNamespace())
 	}
+}
 
+// GetConfig gets the cert from every controller. The last good cert is returned for a controller whose cert could not be retrieved or is invalid.
+func (p *Provider) GetConfig() (*api.EnvironmentConfig, error) {
+	targets, err := p.resolveControllers()
 	if err != nil {
-		r.log.Error(err, "Error setting environment config. Retrying...")
-		time.AfterFunc(retryOnFailureSeconds, r.refresh)
+		return nil, errors.Wrap(err, "Error resolving sealed secret controllers")
 	}
 
+	var fetchErr error
+	certs := []api.SealedSecretCert{}
+	for _, target := range targets {
+		log := p.log.WithValues("controller", target.name, "namespace", target.namespace)
+		key := fmt.Sprintf("%s/%s", target.namespace, target.name)
+		certBytes, err := p.fetcher.fetch(target)
+		if err != nil {
+			log.Error(err, "Error retrieving cert from the sealed secret controller")
+			fetchErr = errors.Wrap(err, fmt.Sprintf("Error retrieving cert from the sealed secret controller %q", key))
+		} else {
+			cert, err := parseCert(certBytes, p.certValidation, time.Now())
+			if err == nil {
+				certValid.WithLabelValues(target.name, target.namespace).Set(1)
+				certExpiry.WithLabelValues(target.name, target.namespace).Set(float64(cert.NotAfter.Unix()))
+				log.Info("Retrieved cert for sealed secrets", "fingerprint", fingerprint(cert), "expires", cert.NotAfter)
+				p.certs[key] = api.SealedSecretCert{
+					Controller:          target.name,
+					ControllerNamespace: target.namespace,
+					Cert:                certBytes,
+					Namespaces:          target.namespaces,
+					Apps:                target.apps,
+				}
+				p.certEnvironments[key] = target.environments
+			} else {
+				// Retrying is unlikely to help. Wait for the next refresh.
+				certValid.WithLabelValues(target.name, target.namespace).Set(0)
+				log.Error(err, "Invalid cert received from the sealed secret controller. The cert will not be updated.")
+			}
+		}
+
+		if cert, ok := p.certs[key]; ok {
+			certs = append(certs, cert)
+		}
+	}
+
+	if len(certs) == 0 {
+		return nil, fetchErr
+	}
+
+	return &api.EnvironmentConfig{
+		EnvironmentConfig: model.EnvironmentConfig{
+			SealedSecretCert: getDefaultCert(certs),
+		},
+		SealedSecretCerts: certs,
+	}, fetchErr
+}
+
+// resolveControllers returns the controllers specified by name along with the controllers matching each selector
+func (p *Provider) resolveControllers() ([]controllerTarget, error) {
+	targets := []controllerTarget{}
+	for _, controller := range p.controllers {
+		if controller.Selector == "" {
+			targets = append(targets, controllerTarget{controller.Name, controller.Namespace, controller.Namespaces, controller.Apps, controller.CertFile, controller.Environments})
+			continue
+		}
+
+		services, err := p.kubeClient.Services(controller.Namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: controller.Selector})
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error listing services with selector %q", controller.Selector))
+		}
+		for _, service := range services.Items {
+			targets = append(targets, controllerTarget{service.Name, service.Namespace, controller.Namespaces, controller.Apps, controller.CertFile, controller.Environments})
+		}
+	}
+	return targets, nil
+}
+
+// ForEnvironment returns the config with only the certs of the controllers for the environment. A controller without any environments is used
+// for all environments.
+func (p *Provider) ForEnvironment(config *api.EnvironmentConfig, environmentName string) *api.EnvironmentConfig {
+	certs := []api.SealedSecretCert{}
+	for _, cert := range config.SealedSecretCerts {
+		environments := p.certEnvironments[fmt.Sprintf("%s/%s", cert.ControllerNamespace, cert.Controller)]
+		if len(environments) == 0 || util.ContainsString(environments, environmentName) {
+			certs = append(certs, cert)
+		}
+	}
+
+	if len(certs) == 0 {
+		return nil
+	}
+
+	return &api.EnvironmentConfig{
+		EnvironmentConfig: model.EnvironmentConfig{
+			SealedSecretCert: getDefaultCert(certs),
+		},
+		SealedSecretCerts: certs,
+	}
+}
+
+// getDefaultCert returns the cert of the first controller without any namespaces or apps. Falls back to the first cert.
+func getDefaultCert(certs []api.SealedSecretCert) []byte {
+	for _, cert := range certs {
+		if len(cert.Namespaces) == 0 && len(cert.Apps) == 0 {
+			return cert.Cert
+		}
+	}
+	return certs[0].Cert
 }
@@ -0,0 +1,162 @@
+package sealedsecret
+
+import (
+	"errors"
+	"riser-controller/pkg/api"
+	"riser-controller/pkg/runtime"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func Test_getWatchNamespaces(t *testing.T) {
+	controllers := []runtime.SealedSecretController{
+		{Name: "sealed-secrets-controller", Namespace: "kube-system"},
+		{Name: "tenant-a", Namespace: "tenant-a"},
+		{Name: "other", Namespace: "kube-system"},
+	}
+
+	assert.Equal(t, []string{"kube-system", "tenant-a"}, getWatchNamespaces(controllers))
+}
+
+func Test_getWatchNamespaces_AllNamespaces(t *testing.T) {
+	controllers := []runtime.SealedSecretController{
+		{Name: "sealed-secrets-controller", Namespace: "kube-system"},
+		{Selector: "app.kubernetes.io/name=sealed-secrets"},
+	}
+
+	assert.Equal(t, []string{""}, getWatchNamespaces(controllers))
+}
+
+func Test_getDefaultCert(t *testing.T) {
+	certs := []api.SealedSecretCert{
+		{Controller: "tenant-a", Cert: []byte("a"), Namespaces: []string{"tenant-a"}},
+		{Controller: "default", Cert: []byte("default")},
+		{Controller: "tenant-b", Cert: []byte("b"), Apps: []string{"myapp"}},
+	}
+
+	assert.Equal(t, []byte("default"), getDefaultCert(certs))
+}
+
+func Test_getDefaultCert_FallsBackToFirstCert(t *testing.T) {
+	certs := []api.SealedSecretCert{
+		{Controller: "tenant-a", Cert: []byte("a"), Namespaces: []string{"tenant-a"}},
+		{Controller: "tenant-b", Cert: []byte("b"), Apps: []string{"myapp"}},
+	}
+
+	assert.Equal(t, []byte("a"), getDefaultCert(certs))
+}
+
+func Test_ForEnvironment(t *testing.T) {
+	provider := &Provider{
+		certEnvironments: map[string][]string{
+			"kube-system/all":  nil,
+			"tenant-a/prod":    {"prod"},
+			"tenant-b/staging": {"staging"},
+		},
+	}
+	config := &api.EnvironmentConfig{
+		SealedSecretCerts: []api.SealedSecretCert{
+			{Controller: "all", ControllerNamespace: "kube-system", Cert: []byte("all"), Namespaces: []string{"shared"}},
+			{Controller: "prod", ControllerNamespace: "tenant-a", Cert: []byte("prod")},
+			{Controller: "staging", ControllerNamespace: "tenant-b", Cert: []byte("staging")},
+		},
+	}
+
+	result := provider.ForEnvironment(config, "prod")
+
+	assert.Len(t, result.SealedSecretCerts, 2)
+	assert.Equal(t, "all", result.SealedSecretCerts[0].Controller)
+	assert.Equal(t, "prod", result.SealedSecretCerts[1].Controller)
+	assert.Equal(t, []byte("prod"), result.SealedSecretCert)
+}
+
+func Test_ForEnvironment_NoCerts(t *testing.T) {
+	provider := &Provider{
+		certEnvironments: map[string][]string{"tenant-a/prod": {"prod"}},
+	}
+	config := &api.EnvironmentConfig{
+		SealedSecretCerts: []api.SealedSecretCert{{Controller: "prod", ControllerNamespace: "tenant-a", Cert: []byte("prod")}},
+	}
+
+	assert.Nil(t, provider.ForEnvironment(config, "dev"))
+}
+
+func Test_watchKeys(t *testing.T) {
+	scheme := k8sruntime.NewScheme()
+	require.NoError(t, metav1.AddMetaToScheme(scheme))
+	metadataClient := metadatafake.NewSimpleMetadataClient(scheme, newTestKey("existing", "1"))
+	secrets := metadataClient.Resource(corev1.SchemeGroupVersion.WithResource("secrets")).Namespace("kube-system").(metadatafake.MetadataClient)
+	refreshed := make(chan struct{}, 10)
+	provider := &Provider{log: logr.Discard()}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	err := provider.watchKeys(metadataClient, "kube-system", func() { refreshed <- struct{}{} }, stopCh)
+	require.NoError(t, err)
+
+	assertNotRefreshed(t, refreshed, "when the key existed when the watch started")
+
+	_, err = secrets.CreateFake(newTestKey("added", "1"), metav1.CreateOptions{})
+	require.NoError(t, err)
+	assertRefreshed(t, refreshed, "when a key is added")
+
+	_, err = secrets.UpdateFake(newTestKey("existing", "2"), metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assertRefreshed(t, refreshed, "when a key is updated")
+}
+
+func Test_watchKeys_ListError(t *testing.T) {
+	scheme := k8sruntime.NewScheme()
+	require.NoError(t, metav1.AddMetaToScheme(scheme))
+	metadataClient := metadatafake.NewSimpleMetadataClient(scheme)
+	metadataClient.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+		return true, nil, kerrors.NewForbidden(corev1.Resource("secrets"), "", errors.New("forbidden"))
+	})
+	provider := &Provider{log: logr.Discard()}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	err := provider.watchKeys(metadataClient, "kube-system", func() {}, stopCh)
+
+	assert.Error(t, err)
+}
+
+func newTestKey(name, resourceVersion string) *metav1.PartialObjectMetadata {
+	return &metav1.PartialObjectMetadata{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       "kube-system",
+			UID:             types.UID(name),
+			ResourceVersion: resourceVersion,
+			Labels:          map[string]string{keyLabel: "active"},
+		},
+	}
+}
+
+func assertRefreshed(t *testing.T, refreshed chan struct{}, msg string) {
+	select {
+	case <-refreshed:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "expected a refresh", msg)
+	}
+}
+
+func assertNotRefreshed(t *testing.T, refreshed chan struct{}, msg string) {
+	select {
+	case <-refreshed:
+		assert.Fail(t, "unexpected refresh", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
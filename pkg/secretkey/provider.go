@@ -0,0 +1,130 @@
+/*
+Package secretkey publishes the keys that the riser server uses to encrypt (or reference) secrets for an environment. Each secret backend
+(e.g. sealed secrets, SOPS, External Secrets Operator) is a Provider.
+*/
+package secretkey
+
+import (
+	"riser-controller/pkg/api"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const retryOnFailureDuration = 5 * time.Second
+
+// Provider provides the environment config for a secret backend. The riser server merges non-empty config values, so a provider should only
+// populate the fields for its own backend.
+type Provider interface {
+	Name() string
+	// GetConfig returns the environment config to publish. A non-nil config is published even when an error is returned (e.g. when only some
+	// keys could be retrieved). An error always results in a retry.
+	GetConfig() (*api.EnvironmentConfig, error)
+}
+
+// EnvironmentFilter is implemented by providers whose config differs between environments (see multi-environment mode)
+type EnvironmentFilter interface {
+	// ForEnvironment returns the config for the environment or nil if the provider has no config for the environment
+	ForEnvironment(config *api.EnvironmentConfig, environmentName string) *api.EnvironmentConfig
+}
+
+// Watcher is implemented by providers that can detect when their keys change
+type Watcher interface {
+	// Watch calls refresh whenever the provider's keys change
+	Watch(refresh func()) error
+}
+
+// Refresher publishes a provider's config to the riser server
+type Refresher struct {
+	provider         Provider
+	environmentNames []string
+	log              logr.Logger
+	ticker           *time.Ticker
+	trigger          chan struct{}
+	riserClient      *api.Client
+}
+
+// StartRefresher publishes the provider's config to each environment on startup and on an interval. Providers that implement Watcher are also
+// refreshed whenever their keys change. The first refresh happens in the background so that startup is not blocked by an unavailable riser
+// server. Refresh errors are logged but are not considered fatal.
+func StartRefresher(provider Provider, riserClient *api.Client, environmentNames []string, refreshInterval time.Duration, log logr.Logger) (*Refresher, error) {
+	r := &Refresher{
+		provider:         provider,
+		environmentNames: environmentNames,
+		log:              log,
+		ticker:           time.NewTicker(refreshInterval),
+		trigger:          make(chan struct{}, 1),
+		riserClient:      riserClient,
+	}
+
+	r.start()
+
+	if watcher, ok := provider.(Watcher); ok {
+		return r, watcher.Watch(r.triggerRefresh)
+	}
+	return r, nil
+}
+
+// SetInterval changes the refresh interval. The next refresh happens after the new interval has elapsed.
+func (r *Refresher) SetInterval(refreshInterval time.Duration) {
+	r.ticker.Reset(refreshInterval)
+}
+
+func (r *Refresher) start() {
+	go func() {
+		r.refresh()
+		for {
+			select {
+			case <-r.ticker.C:
+			case <-r.trigger:
+			}
+			r.refresh()
+		}
+	}()
+}
+
+// triggerRefresh requests a refresh without blocking. Multiple requests while a refresh is pending are coalesced into a single refresh.
+func (r *Refresher) triggerRefresh() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Refresher) refresh() {
+	config, err := r.provider.GetConfig()
+	if err != nil {
+		r.log.Error(err, "Error getting secret keys. Retrying...", "provider", r.provider.Name())
+	}
+
+	if config != nil {
+		for _, environmentName := range r.environmentNames {
+			setErr := r.publish(config, environmentName)
+			if setErr != nil {
+				r.log.Error(setErr, "Error setting environment config. Retrying...", "provider", r.provider.Name(), "environment", environmentName)
+				err = setErr
+			}
+		}
+	}
+
+	if err != nil {
+		time.AfterFunc(retryOnFailureDuration, r.triggerRefresh)
+	}
+}
+
+// publish sets the environment config. Nothing is published when the provider has no config for the environment since the server ignores empty
+// values.
+func (r *Refresher) publish(config *api.EnvironmentConfig, environmentName string) error {
+	if filter, ok := r.provider.(EnvironmentFilter); ok {
+		config = filter.ForEnvironment(config, environmentName)
+		if config == nil {
+			return nil
+		}
+	}
+	if config.IsEmpty() {
+		r.log.V(1).Info("No secret keys to update", "provider", r.provider.Name(), "environment", environmentName)
+		return nil
+	}
+	r.log.Info("Updating secret keys", "provider", r.provider.Name(), "environment", environmentName)
+	return api.SetEnvironmentConfig(r.riserClient, environmentName, config)
+}
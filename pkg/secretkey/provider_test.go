@@ -0,0 +1,142 @@
+package secretkey
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"riser-controller/pkg/api"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_StartRefresher_Watch(t *testing.T) {
+	provider := newFakeProvider()
+
+	refresher, err := StartRefresher(provider, nil, []string{"dev"}, time.Hour, logr.Discard())
+	require.NoError(t, err)
+	defer refresher.ticker.Stop()
+	assertRefreshed(t, provider.refreshed, "when the refresher starts")
+
+	provider.watchRefresh()
+
+	assertRefreshed(t, provider.refreshed, "when the watch triggers a refresh")
+	assertNotRefreshed(t, provider.refreshed, "when the ticker has not fired")
+}
+
+func Test_StartRefresher_DoesNotBlock(t *testing.T) {
+	provider := newFakeProvider()
+	provider.block = make(chan struct{})
+
+	refresher, err := StartRefresher(provider, nil, []string{"dev"}, time.Hour, logr.Discard())
+	require.NoError(t, err)
+	defer refresher.ticker.Stop()
+	close(provider.block)
+
+	assertRefreshed(t, provider.refreshed, "when the first refresh is unblocked")
+}
+
+func Test_StartRefresher_WatchError(t *testing.T) {
+	provider := newFakeProvider()
+	provider.watchErr = errors.New("watch failed")
+
+	refresher, err := StartRefresher(provider, nil, []string{"dev"}, time.Hour, logr.Discard())
+	defer refresher.ticker.Stop()
+
+	assert.Equal(t, provider.watchErr, err)
+}
+
+func Test_Refresher_Ticker(t *testing.T) {
+	provider := newFakeProvider()
+
+	refresher, err := StartRefresher(provider, nil, []string{"dev"}, 10*time.Millisecond, logr.Discard())
+	require.NoError(t, err)
+	defer refresher.ticker.Stop()
+
+	assertRefreshed(t, provider.refreshed, "when the refresher starts")
+	assertRefreshed(t, provider.refreshed, "when the ticker fires without a trigger")
+}
+
+func Test_Refresher_SetInterval(t *testing.T) {
+	provider := newFakeProvider()
+	refresher, err := StartRefresher(provider, nil, []string{"dev"}, time.Hour, logr.Discard())
+	require.NoError(t, err)
+	defer refresher.ticker.Stop()
+	assertRefreshed(t, provider.refreshed, "when the refresher starts")
+
+	refresher.SetInterval(10 * time.Millisecond)
+
+	assertRefreshed(t, provider.refreshed, "when the interval is shortened")
+}
+
+func Test_Refresher_triggerRefresh_Coalesces(t *testing.T) {
+	refresher := &Refresher{trigger: make(chan struct{}, 1)}
+
+	refresher.triggerRefresh()
+	refresher.triggerRefresh()
+	refresher.triggerRefresh()
+
+	assert.Len(t, refresher.trigger, 1)
+}
+
+func Test_Refresher_publish_SkipsEmptyConfig(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Fail(t, "unexpected request", "%s %s", r.Method, r.URL.Path)
+	}))
+	defer server.Close()
+	riserClient, err := api.NewClient(server.URL, "apikey", api.ClientOptions{})
+	require.NoError(t, err)
+	refresher := &Refresher{provider: newFakeProvider(), riserClient: riserClient, log: logr.Discard()}
+
+	err = refresher.publish(&api.EnvironmentConfig{ExternalSecretStores: []api.ExternalSecretStore{}}, "dev")
+
+	assert.NoError(t, err)
+}
+
+type fakeProvider struct {
+	refreshed    chan struct{}
+	block        chan struct{}
+	watchErr     error
+	watchRefresh func()
+}
+
+func newFakeProvider() *fakeProvider {
+	return &fakeProvider{refreshed: make(chan struct{}, 10)}
+}
+
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+// GetConfig returns a nil config so that nothing is published
+func (p *fakeProvider) GetConfig() (*api.EnvironmentConfig, error) {
+	if p.block != nil {
+		<-p.block
+	}
+	p.refreshed <- struct{}{}
+	return nil, nil
+}
+
+func (p *fakeProvider) Watch(refresh func()) error {
+	p.watchRefresh = refresh
+	return p.watchErr
+}
+
+func assertRefreshed(t *testing.T, refreshed chan struct{}, msg string) {
+	select {
+	case <-refreshed:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "expected a refresh", msg)
+	}
+}
+
+func assertNotRefreshed(t *testing.T, refreshed chan struct{}, msg string) {
+	select {
+	case <-refreshed:
+		assert.Fail(t, "unexpected refresh", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,109 @@
+package sops
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"riser-controller/pkg/api"
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1Client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// ageKey is the ConfigMap key containing age recipients
+	ageKey = "age"
+	// pgpKey is the ConfigMap key containing PGP fingerprints
+	pgpKey = "pgp"
+)
+
+var pgpFingerprintRegex = regexp.MustCompile("^[0-9A-Fa-f]{40}$")
+
+// Provider is a secretkey.Provider for SOPS recipients stored in a ConfigMap
+type Provider struct {
+	configMapName      string
+	configMapNamespace string
+	kubeClient         *corev1Client.CoreV1Client
+}
+
+/*
+	NewProvider creates a provider that reads SOPS recipients from a ConfigMap. Recipients are separated by a comma or a newline and lines
+	starting with "#" are ignored. Only public recipients are read so the ConfigMap must never contain private keys. e.g.
+
+	data:
+	  age: |
+	    age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+	  pgp: FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4
+*/
+func NewProvider(kubeConfig *rest.Config, configMapName string, configMapNamespace string) (*Provider, error) {
+	client, err := corev1Client.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to create rest client for SOPS provider")
+	}
+	return &Provider{
+		configMapName:      configMapName,
+		configMapNamespace: configMapNamespace,
+		kubeClient:         client,
+	}, nil
+}
+
+func (p *Provider) Name() string {
+	return "sops"
+}
+
+func (p *Provider) GetConfig() (*api.EnvironmentConfig, error) {
+	cm, err := p.kubeClient.ConfigMaps(p.configMapNamespace).Get(context.TODO(), p.configMapName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error getting SOPS configmap %s/%s", p.configMapNamespace, p.configMapName))
+	}
+
+	sopsConfig, err := parseRecipients(cm.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.EnvironmentConfig{Sops: sopsConfig}, nil
+}
+
+func parseRecipients(data map[string]string) (*api.SopsConfig, error) {
+	sopsConfig := &api.SopsConfig{
+		AgeRecipients:   splitRecipients(data[ageKey]),
+		PGPFingerprints: splitRecipients(data[pgpKey]),
+	}
+
+	for _, recipient := range sopsConfig.AgeRecipients {
+		if !strings.HasPrefix(recipient, "age1") {
+			return nil, fmt.Errorf("Invalid age recipient %q: age recipients must start with \"age1\"", recipient)
+		}
+	}
+	for _, fingerprint := range sopsConfig.PGPFingerprints {
+		if !pgpFingerprintRegex.MatchString(fingerprint) {
+			return nil, fmt.Errorf("Invalid PGP fingerprint %q: expected 40 hexadecimal characters", fingerprint)
+		}
+	}
+
+	if len(sopsConfig.AgeRecipients) == 0 && len(sopsConfig.PGPFingerprints) == 0 {
+		return nil, fmt.Errorf("No SOPS recipients found. Expected %q or %q keys", ageKey, pgpKey)
+	}
+
+	return sopsConfig, nil
+}
+
+func splitRecipients(value string) []string {
+	recipients := []string{}
+	for _, line := range strings.Split(value, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, recipient := range strings.Split(line, ",") {
+			recipient = strings.TrimSpace(recipient)
+			if recipient != "" {
+				recipients = append(recipients, recipient)
+			}
+		}
+	}
+	return recipients
+}
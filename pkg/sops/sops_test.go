@@ -0,0 +1,61 @@
+package sops
+
+import (
+	"riser-controller/pkg/api"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseRecipients(t *testing.T) {
+	data := map[string]string{
+		"age": `# prod
+age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+age1lggyhqrw2nlhcxprm67z43rta597azn8gknawjehu9d9dl0jq3yqqvfafg, age1yt3tfqlfrwdwx0z0ynwplcr6qxcxfaqycuprpmy89nr83ltx74tqdpszlw
+`,
+		"pgp": "FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4",
+	}
+
+	result, err := parseRecipients(data)
+
+	require.NoError(t, err)
+	assert.Equal(t, &api.SopsConfig{
+		AgeRecipients: []string{
+			"age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p",
+			"age1lggyhqrw2nlhcxprm67z43rta597azn8gknawjehu9d9dl0jq3yqqvfafg",
+			"age1yt3tfqlfrwdwx0z0ynwplcr6qxcxfaqycuprpmy89nr83ltx74tqdpszlw",
+		},
+		PGPFingerprints: []string{"FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4"},
+	}, result)
+}
+
+func Test_parseRecipients_Invalid(t *testing.T) {
+	tt := []struct {
+		name        string
+		data        map[string]string
+		expectedErr string
+	}{
+		{
+			name:        "empty",
+			data:        map[string]string{"age": "# nothing here"},
+			expectedErr: `No SOPS recipients found. Expected "age" or "pgp" keys`,
+		},
+		{
+			name:        "private age key",
+			data:        map[string]string{"age": "AGE-SECRET-KEY-1QQQ"},
+			expectedErr: `Invalid age recipient "AGE-SECRET-KEY-1QQQ": age recipients must start with "age1"`,
+		},
+		{
+			name:        "bad pgp fingerprint",
+			data:        map[string]string{"pgp": "ABC123"},
+			expectedErr: `Invalid PGP fingerprint "ABC123": expected 40 hexadecimal characters`,
+		},
+	}
+
+	for _, test := range tt {
+		result, err := parseRecipients(test.data)
+		assert.Nil(t, result, "when %s", test.name)
+		assert.EqualError(t, err, test.expectedErr, "when %s", test.name)
+	}
+}
@@ -0,0 +1,16 @@
+package status
+
+import (
+	"riser-controller/pkg/api"
+
+	knserving "knative.dev/serving/pkg/apis/serving/v1"
+)
+
+// GetConfigurationStatus returns the configuration's readiness. The Ready condition explains why a deployment is stuck (e.g. RevisionFailed).
+func GetConfigurationStatus(kcfg *knserving.Configuration) *api.ConfigurationStatus {
+	return &api.ConfigurationStatus{
+		Ready:              GetCondition(kcfg.Status.GetCondition(knserving.ConfigurationConditionReady)),
+		Generation:         kcfg.Generation,
+		ObservedGeneration: kcfg.Status.ObservedGeneration,
+	}
+}
@@ -0,0 +1,50 @@
+package status
+
+import (
+	"riser-controller/pkg/api"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	knserving "knative.dev/serving/pkg/apis/serving/v1"
+)
+
+func Test_GetConfigurationStatus(t *testing.T) {
+	kcfg := &knserving.Configuration{
+		ObjectMeta: metav1.ObjectMeta{Generation: 3},
+		Status: knserving.ConfigurationStatus{
+			Status: duckv1.Status{
+				ObservedGeneration: 2,
+				Conditions: duckv1.Conditions{
+					apis.Condition{
+						Type:    knserving.ConfigurationConditionReady,
+						Status:  "False",
+						Reason:  "RevisionFailed",
+						Message: `Revision "mydep-3" failed with message: Unable to fetch image "my/image:0.0.3"`,
+					},
+				},
+			},
+		},
+	}
+
+	result := GetConfigurationStatus(kcfg)
+
+	assert.Equal(t, &api.ConfigurationStatus{
+		Ready: &api.Condition{
+			Type:    "Ready",
+			Status:  "False",
+			Reason:  "RevisionFailed",
+			Message: `Revision "mydep-3" failed with message: Unable to fetch image "my/image:0.0.3"`,
+		},
+		Generation:         3,
+		ObservedGeneration: 2,
+	}, result)
+}
+
+func Test_GetConfigurationStatus_NoStatus(t *testing.T) {
+	result := GetConfigurationStatus(&knserving.Configuration{})
+
+	assert.Equal(t, &api.ConfigurationStatus{}, result)
+}
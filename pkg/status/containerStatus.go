@@ -0,0 +1,65 @@
+package status
+
+import (
+	"riser-controller/pkg/api"
+	"riser-controller/pkg/util"
+
+	corev1 "k8s.io/api/core/v1"
+	knserving "knative.dev/serving/pkg/apis/serving/v1"
+)
+
+// GetContainerStatuses returns the status of every container in the revision. Readiness is aggregated across all of the revision's pods: a
+// container is only considered ready when it is ready in every pod.
+func GetContainerStatuses(rev *knserving.Revision, primaryContainerName string, pods []corev1.Pod) []api.ContainerStatus {
+	digests := map[string]string{}
+	for _, containerStatus := range rev.Status.ContainerStatuses {
+		digests[containerStatus.Name] = containerStatus.ImageDigest
+	}
+
+	statuses := make([]api.ContainerStatus, len(rev.Spec.Containers))
+	for idx, container := range rev.Spec.Containers {
+		statuses[idx] = api.ContainerStatus{
+			Name:        container.Name,
+			Image:       container.Image,
+			ImageDigest: digests[container.Name],
+			Primary:     primaryContainerName != "" && container.Name == primaryContainerName,
+		}
+		statuses[idx].Ready, statuses[idx].Reason = getContainerReadiness(container.Name, pods)
+	}
+
+	return statuses
+}
+
+func getContainerReadiness(containerName string, pods []corev1.Pod) (*bool, string) {
+	if len(pods) == 0 {
+		return nil, ""
+	}
+
+	for _, pod := range pods {
+		found := false
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			if containerStatus.Name != containerName {
+				continue
+			}
+			found = true
+			if !containerStatus.Ready {
+				return util.PtrBool(false), getContainerNotReadyReason(containerStatus)
+			}
+		}
+		if !found {
+			return util.PtrBool(false), "Pending"
+		}
+	}
+
+	return util.PtrBool(true), ""
+}
+
+func getContainerNotReadyReason(containerStatus corev1.ContainerStatus) string {
+	if containerStatus.State.Waiting != nil {
+		return containerStatus.State.Waiting.Reason
+	}
+	if containerStatus.State.Terminated != nil {
+		return containerStatus.State.Terminated.Reason
+	}
+	return "NotReady"
+}
@@ -0,0 +1,96 @@
+package status
+
+import (
+	"riser-controller/pkg/api"
+	"riser-controller/pkg/util"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	knserving "knative.dev/serving/pkg/apis/serving/v1"
+)
+
+func Test_GetContainerStatuses(t *testing.T) {
+	rev := &knserving.Revision{
+		Spec: knserving.RevisionSpec{
+			PodSpec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "app", Image: "my/app:1.0"},
+					{Name: "sidecar", Image: "my/sidecar:1.0"},
+				},
+			},
+		},
+		Status: knserving.RevisionStatus{
+			ContainerStatuses: []knserving.ContainerStatus{
+				{Name: "app", ImageDigest: "my/app@sha256:abc"},
+				{Name: "sidecar", ImageDigest: "my/sidecar@sha256:def"},
+			},
+		},
+	}
+
+	tt := []struct {
+		name     string
+		pods     []corev1.Pod
+		expected []api.ContainerStatus
+	}{
+		{
+			name: "no pods",
+			expected: []api.ContainerStatus{
+				{Name: "app", Image: "my/app:1.0", ImageDigest: "my/app@sha256:abc", Primary: true},
+				{Name: "sidecar", Image: "my/sidecar:1.0", ImageDigest: "my/sidecar@sha256:def"},
+			},
+		},
+		{
+			name: "all containers ready",
+			pods: []corev1.Pod{
+				newPod(corev1.ContainerStatus{Name: "app", Ready: true}, corev1.ContainerStatus{Name: "sidecar", Ready: true}),
+				newPod(corev1.ContainerStatus{Name: "app", Ready: true}, corev1.ContainerStatus{Name: "sidecar", Ready: true}),
+			},
+			expected: []api.ContainerStatus{
+				{Name: "app", Image: "my/app:1.0", ImageDigest: "my/app@sha256:abc", Primary: true, Ready: util.PtrBool(true)},
+				{Name: "sidecar", Image: "my/sidecar:1.0", ImageDigest: "my/sidecar@sha256:def", Ready: util.PtrBool(true)},
+			},
+		},
+		{
+			name: "container not ready in one pod",
+			pods: []corev1.Pod{
+				newPod(corev1.ContainerStatus{Name: "app", Ready: true}, corev1.ContainerStatus{Name: "sidecar", Ready: true}),
+				newPod(
+					corev1.ContainerStatus{
+						Name: "app",
+						State: corev1.ContainerState{
+							Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+						},
+					},
+					corev1.ContainerStatus{Name: "sidecar", Ready: true}),
+			},
+			expected: []api.ContainerStatus{
+				{Name: "app", Image: "my/app:1.0", ImageDigest: "my/app@sha256:abc", Primary: true, Ready: util.PtrBool(false), Reason: "CrashLoopBackOff"},
+				{Name: "sidecar", Image: "my/sidecar:1.0", ImageDigest: "my/sidecar@sha256:def", Ready: util.PtrBool(true)},
+			},
+		},
+		{
+			name: "container status not reported",
+			pods: []corev1.Pod{
+				newPod(corev1.ContainerStatus{Name: "sidecar", Ready: true}),
+			},
+			expected: []api.ContainerStatus{
+				{Name: "app", Image: "my/app:1.0", ImageDigest: "my/app@sha256:abc", Primary: true, Ready: util.PtrBool(false), Reason: "Pending"},
+				{Name: "sidecar", Image: "my/sidecar:1.0", ImageDigest: "my/sidecar@sha256:def", Ready: util.PtrBool(true)},
+			},
+		},
+	}
+
+	for _, test := range tt {
+		result := GetContainerStatuses(rev, "app", test.pods)
+		assert.Equal(t, test.expected, result, "when %s", test.name)
+	}
+}
+
+func newPod(containerStatuses ...corev1.ContainerStatus) corev1.Pod {
+	return corev1.Pod{
+		Status: corev1.PodStatus{
+			ContainerStatuses: containerStatuses,
+		},
+	}
+}
@@ -0,0 +1,105 @@
+package status
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"knative.dev/serving/pkg/apis/serving"
+	knserving "knative.dev/serving/pkg/apis/serving/v1"
+	"knative.dev/serving/pkg/gc"
+)
+
+// GetGarbageCollectionTimes predicts when the knative revision garbage collector will delete each revision of a configuration. Revisions that
+// are not eligible for garbage collection are not included in the result. A time in the past means that the revision is due to be deleted.
+// This approximates the algorithm in knative.dev/serving/pkg/reconciler/gc and will need to be kept in sync when upgrading knative serving.
+func GetGarbageCollectionTimes(cfg *gc.Config, kcfg *knserving.Configuration, revisions []knserving.Revision, now time.Time) map[string]time.Time {
+	gcTimes := map[string]time.Time{}
+	min, max := int(cfg.MinNonActiveRevisions), int(cfg.MaxNonActiveRevisions)
+	if max == gc.Disabled && cfg.RetainSinceCreateTime == gc.Disabled && cfg.RetainSinceLastActiveTime == gc.Disabled {
+		return gcTimes
+	}
+
+	nonActive := []knserving.Revision{}
+	for _, rev := range revisions {
+		if !isRevisionActive(&rev, kcfg) {
+			nonActive = append(nonActive, rev)
+		}
+	}
+
+	if len(revisions) <= min || len(nonActive) <= min {
+		return gcTimes
+	}
+
+	// Oldest first. The newest "min" non-active revisions are always retained.
+	sort.SliceStable(nonActive, func(i, j int) bool {
+		return revisionLastActiveTime(&nonActive[i]).Before(revisionLastActiveTime(&nonActive[j]))
+	})
+	eligible := nonActive[:len(nonActive)-min]
+
+	remaining := len(nonActive)
+	retained := []string{}
+	for _, rev := range eligible {
+		gcTime, ok := getStaleTime(cfg, &rev)
+		if !ok {
+			retained = append(retained, rev.Name)
+			continue
+		}
+		gcTimes[rev.Name] = gcTime
+		if !gcTime.After(now) {
+			remaining--
+		} else {
+			retained = append(retained, rev.Name)
+		}
+	}
+
+	// Revisions past the max are deleted immediately regardless of their age
+	if max != gc.Disabled && remaining > max {
+		excess := remaining - max
+		if excess > len(retained) {
+			excess = len(retained)
+		}
+		for _, name := range retained[:excess] {
+			gcTimes[name] = now
+		}
+	}
+
+	return gcTimes
+}
+
+// getStaleTime returns the time at which the revision is considered stale, or false if time based garbage collection is disabled.
+func getStaleTime(cfg *gc.Config, rev *knserving.Revision) (time.Time, bool) {
+	sinceCreate, sinceActive := cfg.RetainSinceCreateTime, cfg.RetainSinceLastActiveTime
+	if sinceCreate == gc.Disabled && sinceActive == gc.Disabled {
+		return time.Time{}, false
+	}
+
+	staleTime := time.Time{}
+	if sinceCreate != gc.Disabled {
+		staleTime = rev.CreationTimestamp.Time.Add(sinceCreate)
+	}
+	if sinceActive != gc.Disabled {
+		activeStaleTime := revisionLastActiveTime(rev).Add(sinceActive)
+		if activeStaleTime.After(staleTime) {
+			staleTime = activeStaleTime
+		}
+	}
+	return staleTime, true
+}
+
+func isRevisionActive(rev *knserving.Revision, kcfg *knserving.Configuration) bool {
+	if kcfg.Status.LatestReadyRevisionName == rev.Name {
+		return true
+	}
+	if strings.EqualFold(rev.Annotations[serving.RevisionPreservedAnnotationKey], "true") {
+		return true
+	}
+	return rev.GetRoutingState() != knserving.RoutingStateReserve
+}
+
+func revisionLastActiveTime(rev *knserving.Revision) time.Time {
+	if t := rev.GetRoutingStateModified(); !t.IsZero() {
+		return t
+	}
+	return rev.CreationTimestamp.Time
+}
@@ -0,0 +1,117 @@
+package status
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/serving/pkg/apis/serving"
+	knserving "knative.dev/serving/pkg/apis/serving/v1"
+	"knative.dev/serving/pkg/gc"
+)
+
+func Test_GetGarbageCollectionTimes(t *testing.T) {
+	now := time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)
+	kcfg := &knserving.Configuration{
+		Status: knserving.ConfigurationStatus{
+			ConfigurationStatusFields: knserving.ConfigurationStatusFields{
+				LatestReadyRevisionName: "latest",
+			},
+		},
+	}
+	revisions := []knserving.Revision{
+		newGCRevision("latest", now.Add(-1*time.Hour), knserving.RoutingStateActive, now.Add(-1*time.Hour)),
+		newGCRevision("oldest", now.Add(-96*time.Hour), knserving.RoutingStateReserve, now.Add(-72*time.Hour)),
+		newGCRevision("older", now.Add(-72*time.Hour), knserving.RoutingStateReserve, now.Add(-10*time.Hour)),
+		newGCRevision("recent", now.Add(-5*time.Hour), knserving.RoutingStateReserve, now.Add(-2*time.Hour)),
+		newGCRevision("pending", now.Add(-5*time.Hour), knserving.RoutingStatePending, time.Time{}),
+	}
+
+	tt := []struct {
+		name     string
+		cfg      *gc.Config
+		expected map[string]time.Time
+	}{
+		{
+			name: "all settings disabled",
+			cfg: &gc.Config{
+				RetainSinceCreateTime:     gc.Disabled,
+				RetainSinceLastActiveTime: gc.Disabled,
+				MaxNonActiveRevisions:     gc.Disabled,
+			},
+			expected: map[string]time.Time{},
+		},
+		{
+			name: "not enough non-active revisions",
+			cfg: &gc.Config{
+				RetainSinceCreateTime:     48 * time.Hour,
+				RetainSinceLastActiveTime: 15 * time.Hour,
+				MinNonActiveRevisions:     3,
+				MaxNonActiveRevisions:     1000,
+			},
+			expected: map[string]time.Time{},
+		},
+		{
+			name: "time based",
+			cfg: &gc.Config{
+				RetainSinceCreateTime:     48 * time.Hour,
+				RetainSinceLastActiveTime: 15 * time.Hour,
+				MinNonActiveRevisions:     1,
+				MaxNonActiveRevisions:     1000,
+			},
+			expected: map[string]time.Time{
+				"oldest": now.Add(-48 * time.Hour),
+				"older":  now.Add(5 * time.Hour),
+			},
+		},
+		{
+			name: "max non-active revisions exceeded",
+			cfg: &gc.Config{
+				RetainSinceCreateTime:     gc.Disabled,
+				RetainSinceLastActiveTime: gc.Disabled,
+				MinNonActiveRevisions:     0,
+				MaxNonActiveRevisions:     2,
+			},
+			expected: map[string]time.Time{
+				"oldest": now,
+			},
+		},
+	}
+
+	for _, test := range tt {
+		result := GetGarbageCollectionTimes(test.cfg, kcfg, revisions, now)
+		assert.Equal(t, test.expected, result, "when %s", test.name)
+	}
+}
+
+func Test_GetGarbageCollectionTimes_PreservedRevision(t *testing.T) {
+	now := time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)
+	revision := newGCRevision("preserved", now.Add(-96*time.Hour), knserving.RoutingStateReserve, now.Add(-72*time.Hour))
+	revision.Annotations[serving.RevisionPreservedAnnotationKey] = "true"
+	cfg := &gc.Config{
+		RetainSinceCreateTime:     48 * time.Hour,
+		RetainSinceLastActiveTime: 15 * time.Hour,
+		MaxNonActiveRevisions:     1000,
+	}
+
+	result := GetGarbageCollectionTimes(cfg, &knserving.Configuration{}, []knserving.Revision{revision}, now)
+
+	assert.Empty(t, result)
+}
+
+func newGCRevision(name string, created time.Time, routingState knserving.RoutingState, routingStateModified time.Time) knserving.Revision {
+	rev := knserving.Revision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(created),
+			Labels:            map[string]string{},
+			Annotations:       map[string]string{},
+		},
+	}
+	rev.SetRoutingState(routingState, routingStateModified)
+	if routingStateModified.IsZero() {
+		delete(rev.Annotations, serving.RoutingStateModifiedAnnotationKey)
+	}
+	return rev
+}
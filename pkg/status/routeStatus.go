@@ -0,0 +1,79 @@
+package status
+
+import (
+	"riser-controller/pkg/api"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/apis"
+	"knative.dev/serving/pkg/apis/serving"
+	knserving "knative.dev/serving/pkg/apis/serving/v1"
+	knservingv1beta1 "knative.dev/serving/pkg/apis/serving/v1beta1"
+)
+
+// GetRouteStatus returns the route's readiness, URL and ingress readiness along with the status of any domain mappings that reference the route
+func GetRouteStatus(route *knserving.Route, domainMappings []knservingv1beta1.DomainMapping) *api.RouteStatus {
+	routeStatus := &api.RouteStatus{
+		Ready:                  GetCondition(route.Status.GetCondition(knserving.RouteConditionReady)),
+		Generation:             route.Generation,
+		ObservedGeneration:     route.Status.ObservedGeneration,
+		URL:                    urlString(route.Status.URL),
+		IngressReady:           GetCondition(route.Status.GetCondition(knserving.RouteConditionIngressReady)),
+		CertificateProvisioned: GetCondition(route.Status.GetCondition(knserving.RouteConditionCertificateProvisioned)),
+	}
+
+	for _, domainMapping := range domainMappings {
+		if !IsDomainMappingForRoute(&domainMapping, route) {
+			continue
+		}
+		routeStatus.DomainMappings = append(routeStatus.DomainMappings, api.DomainMappingStatus{
+			Name:                   domainMapping.Name,
+			URL:                    urlString(domainMapping.Status.URL),
+			Ready:                  GetCondition(domainMapping.Status.GetCondition(knservingv1beta1.DomainMappingConditionReady)),
+			CertificateProvisioned: GetCondition(domainMapping.Status.GetCondition(knservingv1beta1.DomainMappingConditionCertificateProvisioned)),
+		})
+	}
+
+	return routeStatus
+}
+
+// IsDomainMappingForRoute returns true if the domain mapping references the route (or a knative service with the same name)
+func IsDomainMappingForRoute(domainMapping *knservingv1beta1.DomainMapping, route *knserving.Route) bool {
+	name, ok := GetDomainMappingRoute(domainMapping)
+	return ok && name.Name == route.Name && name.Namespace == route.Namespace
+}
+
+// GetDomainMappingRoute returns the name of the route that the domain mapping references. Returns false if the domain mapping does not reference
+// a knative Route or Service.
+func GetDomainMappingRoute(domainMapping *knservingv1beta1.DomainMapping) (types.NamespacedName, bool) {
+	ref := domainMapping.Spec.Ref
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil || gv.Group != serving.GroupName || (ref.Kind != "Route" && ref.Kind != "Service") {
+		return types.NamespacedName{}, false
+	}
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = domainMapping.Namespace
+	}
+	return types.NamespacedName{Namespace: namespace, Name: ref.Name}, true
+}
+
+// GetCondition returns a simplified knative condition. Returns nil if the condition is nil.
+func GetCondition(cnd *apis.Condition) *api.Condition {
+	if cnd == nil {
+		return nil
+	}
+	return &api.Condition{
+		Type:    string(cnd.Type),
+		Status:  string(cnd.Status),
+		Reason:  cnd.Reason,
+		Message: cnd.Message,
+	}
+}
+
+func urlString(url *apis.URL) string {
+	if url == nil {
+		return ""
+	}
+	return url.String()
+}
@@ -0,0 +1,153 @@
+package status
+
+import (
+	"riser-controller/pkg/api"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	knserving "knative.dev/serving/pkg/apis/serving/v1"
+	knservingv1beta1 "knative.dev/serving/pkg/apis/serving/v1beta1"
+)
+
+func Test_GetRouteStatus(t *testing.T) {
+	route := &knserving.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "mydep",
+			Namespace:  "myns",
+			Generation: 2,
+		},
+		Status: knserving.RouteStatus{
+			Status: duckv1.Status{
+				ObservedGeneration: 2,
+				Conditions: duckv1.Conditions{
+					apis.Condition{
+						Type:    knserving.RouteConditionReady,
+						Status:  "False",
+						Reason:  "RevisionMissing",
+						Message: `Configuration "mydep" does not have any ready Revision.`,
+					},
+					apis.Condition{
+						Type:   knserving.RouteConditionIngressReady,
+						Status: "True",
+					},
+					apis.Condition{
+						Type:    knserving.RouteConditionCertificateProvisioned,
+						Status:  "Unknown",
+						Reason:  "CertificateNotReady",
+						Message: "Certificate is not ready",
+					},
+				},
+			},
+			RouteStatusFields: knserving.RouteStatusFields{
+				URL: &apis.URL{Scheme: "https", Host: "mydep.myns.example.com"},
+			},
+		},
+	}
+	domainMappings := []knservingv1beta1.DomainMapping{
+		newDomainMapping("myapp.example.com", "myns", "", "mydep"),
+		newDomainMapping("other.example.com", "myns", "", "other"),
+		newDomainMapping("crossns.example.com", "otherns", "myns", "mydep"),
+	}
+	domainMappings[0].Status = knservingv1beta1.DomainMappingStatus{
+		Status: duckv1.Status{
+			Conditions: duckv1.Conditions{
+				apis.Condition{Type: knservingv1beta1.DomainMappingConditionReady, Status: "True"},
+			},
+		},
+		URL: &apis.URL{Scheme: "https", Host: "myapp.example.com"},
+	}
+
+	result := GetRouteStatus(route, domainMappings)
+
+	assert.Equal(t, &api.Condition{
+		Type:    "Ready",
+		Status:  "False",
+		Reason:  "RevisionMissing",
+		Message: `Configuration "mydep" does not have any ready Revision.`,
+	}, result.Ready)
+	assert.EqualValues(t, 2, result.Generation)
+	assert.EqualValues(t, 2, result.ObservedGeneration)
+	assert.Equal(t, "https://mydep.myns.example.com", result.URL)
+	assert.Equal(t, &api.Condition{Type: "IngressReady", Status: "True"}, result.IngressReady)
+	assert.Equal(t, &api.Condition{
+		Type:    "CertificateProvisioned",
+		Status:  "Unknown",
+		Reason:  "CertificateNotReady",
+		Message: "Certificate is not ready",
+	}, result.CertificateProvisioned)
+	require.Len(t, result.DomainMappings, 2)
+	assert.Equal(t, api.DomainMappingStatus{
+		Name:  "myapp.example.com",
+		URL:   "https://myapp.example.com",
+		Ready: &api.Condition{Type: "Ready", Status: "True"},
+	}, result.DomainMappings[0])
+	assert.Equal(t, "crossns.example.com", result.DomainMappings[1].Name)
+}
+
+func Test_GetRouteStatus_NoStatus(t *testing.T) {
+	result := GetRouteStatus(&knserving.Route{}, nil)
+
+	assert.Equal(t, &api.RouteStatus{}, result)
+}
+
+func Test_IsDomainMappingForRoute_WhenNotKnative(t *testing.T) {
+	route := &knserving.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mydep",
+			Namespace: "myns",
+		},
+	}
+	domainMapping := newDomainMapping("myapp.example.com", "myns", "", "mydep")
+	domainMapping.Spec.Ref.APIVersion = "v1"
+
+	assert.False(t, IsDomainMappingForRoute(&domainMapping, route))
+}
+
+func Test_GetDomainMappingRoute(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiVersion string
+		kind       string
+		expected   bool
+	}{
+		{"service", "serving.knative.dev/v1", "Service", true},
+		{"route", "serving.knative.dev/v1", "Route", true},
+		{"configuration", "serving.knative.dev/v1", "Configuration", false},
+		{"not knative", "v1", "Service", false},
+	}
+
+	for _, tt := range tests {
+		domainMapping := newDomainMapping("myapp.example.com", "myns", "", "mydep")
+		domainMapping.Spec.Ref.APIVersion = tt.apiVersion
+		domainMapping.Spec.Ref.Kind = tt.kind
+
+		name, ok := GetDomainMappingRoute(&domainMapping)
+
+		assert.Equal(t, tt.expected, ok, "when %s", tt.name)
+		if tt.expected {
+			assert.Equal(t, types.NamespacedName{Namespace: "myns", Name: "mydep"}, name, "when %s", tt.name)
+		}
+	}
+}
+
+func newDomainMapping(name, namespace, refNamespace, refName string) knservingv1beta1.DomainMapping {
+	return knservingv1beta1.DomainMapping{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: knservingv1beta1.DomainMappingSpec{
+			Ref: duckv1.KReference{
+				APIVersion: "serving.knative.dev/v1",
+				Kind:       "Service",
+				Namespace:  refNamespace,
+				Name:       refName,
+			},
+		},
+	}
+}
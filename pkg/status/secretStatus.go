@@ -0,0 +1,37 @@
+package status
+
+import (
+	"riser-controller/pkg/api"
+	"riser-controller/pkg/util"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ReasonDecryptionFailed is reported when the sealed secret controller does not have a key that can unseal the secret. This usually means that
+// the secret was sealed with a stale or foreign key.
+const ReasonDecryptionFailed = "DecryptionFailed"
+
+// GetSecretStatuses returns the sync status of each SealedSecret. The status is read from the "Synced" condition set by the sealed secret controller.
+func GetSecretStatuses(sealedSecrets []unstructured.Unstructured) []api.SecretStatus {
+	statuses := make([]api.SecretStatus, len(sealedSecrets))
+	for idx, sealedSecret := range sealedSecrets {
+		statuses[idx] = api.SecretStatus{Name: sealedSecret.GetName()}
+
+		conditions, _, _ := unstructured.NestedSlice(sealedSecret.Object, "status", "conditions")
+		for _, c := range conditions {
+			condition, ok := c.(map[string]interface{})
+			if !ok || condition["type"] != "Synced" {
+				continue
+			}
+			synced := condition["status"] == "True"
+			statuses[idx].Synced = util.PtrBool(synced)
+			statuses[idx].Reason, _ = condition["reason"].(string)
+			statuses[idx].Message, _ = condition["message"].(string)
+			if !synced && statuses[idx].Reason == "" && strings.Contains(statuses[idx].Message, "no key could decrypt secret") {
+				statuses[idx].Reason = ReasonDecryptionFailed
+			}
+		}
+	}
+	return statuses
+}
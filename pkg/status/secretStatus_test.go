@@ -0,0 +1,51 @@
+package status
+
+import (
+	"riser-controller/pkg/api"
+	"riser-controller/pkg/util"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func Test_GetSecretStatuses(t *testing.T) {
+	sealedSecrets := []unstructured.Unstructured{
+		newSealedSecret("synced", map[string]interface{}{"type": "Synced", "status": "True"}),
+		newSealedSecret("stalekey", map[string]interface{}{
+			"type":    "Synced",
+			"status":  "False",
+			"message": "no key could decrypt secret (password)",
+		}),
+		newSealedSecret("failed", map[string]interface{}{
+			"type":    "Synced",
+			"status":  "False",
+			"reason":  "ErrUpdateFailed",
+			"message": "Resource already exists and is not managed by SealedSecret",
+		}),
+		newSealedSecret("notobserved"),
+	}
+
+	result := GetSecretStatuses(sealedSecrets)
+
+	assert.Equal(t, []api.SecretStatus{
+		{Name: "synced", Synced: util.PtrBool(true)},
+		{Name: "stalekey", Synced: util.PtrBool(false), Reason: ReasonDecryptionFailed, Message: "no key could decrypt secret (password)"},
+		{Name: "failed", Synced: util.PtrBool(false), Reason: "ErrUpdateFailed", Message: "Resource already exists and is not managed by SealedSecret"},
+		{Name: "notobserved"},
+	}, result)
+}
+
+func newSealedSecret(name string, conditions ...interface{}) unstructured.Unstructured {
+	sealedSecret := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name": name,
+			},
+		},
+	}
+	if len(conditions) > 0 {
+		sealedSecret.Object["status"] = map[string]interface{}{"conditions": conditions}
+	}
+	return sealedSecret
+}
@@ -1,5 +1,8 @@
 package util
 
+// KNativeServingNamespace is the namespace that knative serving is installed in
+const KNativeServingNamespace = "knative-serving"
+
 func PtrInt32(v int32) *int32 {
 	return &v
 }
@@ -11,3 +14,22 @@ func PtrInt64(v int64) *int64 {
 func PtrBool(v bool) *bool {
 	return &v
 }
+
+func ContainsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// IsClosed returns true if the channel is closed. Returns false for a nil channel.
+func IsClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,17 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_IsClosed(t *testing.T) {
+	assert.False(t, IsClosed(nil))
+
+	c := make(chan struct{})
+	assert.False(t, IsClosed(c))
+
+	close(c)
+	assert.True(t, IsClosed(c))
+}
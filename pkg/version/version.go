@@ -0,0 +1,7 @@
+// Package version contains the controller's build information. Values are set at build time with -ldflags (see Dockerfile)
+package version
+
+var (
+	Version = "dev"
+	Commit  = "unknown"
+)